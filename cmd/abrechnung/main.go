@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"emperror.dev/emperror"
 	"encoding/csv"
@@ -170,7 +171,7 @@ func main() {
 
 	mediaIds := map[string][]string{}
 
-	if err := mte.Scroll(scrollConfig, func(data *search.SourceData) error {
+	if err := mte.Scroll(context.Background(), scrollConfig, func(data *search.SourceData) error {
 		if data.HasMedia == false {
 			return nil
 		}
@@ -17,12 +17,14 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"emperror.dev/errors"
 	"flag"
 	"fmt"
 	"github.com/je4/elasticdsl/v2/pkg/bulk"
 	"github.com/je4/zsearch/v2/pkg/search"
 	"os"
+	"os/signal"
 	"time"
 	/*
 		"github.com/ampproject/amppackager/packager/certcache"
@@ -74,6 +76,7 @@ https://mediathek-hgk-fhnw-ch.cdn.ampproject.org/c/s/mediathek.hgk.fhnw.ch/amp/d
 func main() {
 
 	cfgfile := flag.String("cfg", "./search.toml", "locations of config file")
+	after := flag.String("after", "", "resume copy after this signature")
 	flag.Parse()
 	config := LoadConfig(*cfgfile)
 
@@ -123,14 +126,19 @@ func main() {
 	if err := target.StartBulk(3, int(5e+6), 30*time.Second); err != nil {
 		logger.Fatalf("cannot start bulk indexing: %v", err)
 	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
 	var counter int64
-	mtElasticWrapper.Scroll(&search.ScrollConfig{
+	var lastSignature = *after
+	if err := mtElasticWrapper.Scroll(ctx, &search.ScrollConfig{
 		Fields:         nil,
 		QStr:           "*",
 		FiltersFields:  nil,
 		Groups:         nil,
 		ContentVisible: false,
 		IsAdmin:        false,
+		After:          *after,
 	}, func(data *search.SourceData) error {
 		counter++
 		data.SetStatistics()
@@ -138,7 +146,10 @@ func main() {
 		if err := target.Index(data.Signature, data); err != nil {
 			return errors.Wrapf(err, "cannot add signature '%s'", data.Signature)
 		}
+		lastSignature = data.Signature
 		return nil
-	})
+	}); err != nil {
+		logger.Errorf("copy aborted, resume with -after '%s': %v", lastSignature, err)
+	}
 	target.CloseBulk()
 }
@@ -19,6 +19,8 @@ package main
 import (
 	"fmt"
 	"github.com/BurntSushi/toml"
+	"github.com/je4/utils/v2/pkg/config"
+	"github.com/je4/zsearch/v2/pkg/search"
 	"log"
 	"net"
 	"strings"
@@ -102,6 +104,36 @@ type Cfg_ElasticSearch struct {
 	ApiKey   string   `toml:"apikey"`
 }
 
+type Cfg_Bleve struct {
+	Path string `toml:"path"`
+}
+
+type Cfg_Embedding struct {
+	OpenaiApiKey config.EnvString `toml:"openaiapikey"`
+	CacheSize    int              `toml:"cachesize"`
+}
+
+// Cfg_Timeout limits the requests to the search engine, requests which take longer end with 504
+type Cfg_Timeout struct {
+	Search     duration `toml:"search"`
+	Stats      duration `toml:"stats"`
+	LastUpdate duration `toml:"lastupdate"`
+	Delete     duration `toml:"delete"`
+	Load       duration `toml:"load"`
+}
+
+// Cfg_ResultCache caches search results, size < 0 disables the cache
+type Cfg_ResultCache struct {
+	Size int      `toml:"size"`
+	TTL  duration `toml:"ttl"`
+}
+
+// Cfg_Analytics enables the recording of searches and clicks if dir is set
+type Cfg_Analytics struct {
+	Dir       string   `toml:"dir"`
+	Retention duration `toml:"retention"`
+}
+
 type Cfg_Google struct {
 	Apikey           string `toml:"apikey"`
 	CustomSearchKeys map[string]struct {
@@ -160,12 +192,23 @@ type Config struct {
 	CacheDir            string              `toml:"cachedir"`
 	ClearCacheOnStartup bool                `toml:"clearcacheonstartup"`
 	CacheExpiry         duration            `toml:"cacheexpiry"`
+	CacheWatch          duration            `toml:"cachewatch"`
+	CacheBackend        string              `toml:"cachebackend"`
+	CacheSize           int                 `toml:"cachesize"`
+	CacheSweep          duration            `toml:"cachesweep"`
 	SearchFields        map[string]string   `toml:"searchfields"`
 	Facets              []Facet             `toml:"facets"`
 	Locations           []Network           `toml:"locations"`
 	Icons               map[string]string   `toml:"icons"`
 	FacebookAppId       string              `toml:"facebookappid"`
+	SearchEngine        string              `toml:"searchengine"`
 	ElasticSearch       Cfg_ElasticSearch   `toml:"elasticsearch"`
+	Bleve               Cfg_Bleve           `toml:"bleve"`
+	Embedding           Cfg_Embedding       `toml:"embedding"`
+	Ranking             search.Ranking      `toml:"ranking"`
+	Analytics           Cfg_Analytics       `toml:"analytics"`
+	Timeout             Cfg_Timeout         `toml:"timeout"`
+	ResultCache         Cfg_ResultCache     `toml:"resultcache"`
 	Google              Cfg_Google          `toml:"google"`
 	InstanceName        string              `toml:"instancename"`
 	SSHTunnel           SSHTunnel           `toml:"sshtunnel"`
@@ -205,8 +248,63 @@ func LoadConfig(filepath string) Config {
 		}
 		conf.Prefixes[name] = strings.Trim(val, "/")
 	}
+	if conf.SearchEngine == "" {
+		conf.SearchEngine = "elastic"
+	}
+	if conf.Embedding.CacheSize == 0 {
+		conf.Embedding.CacheSize = 1000
+	}
 	if conf.CacheExpiry.Duration == 0 {
 		conf.CacheExpiry.Duration = 3 * time.Hour
 	}
+	if conf.CacheBackend == "" {
+		conf.CacheBackend = search.CacheBackendBadger
+	}
+	if conf.CacheSize == 0 {
+		conf.CacheSize = 10000
+	}
+	if conf.CacheSweep.Duration == 0 {
+		conf.CacheSweep.Duration = 15 * time.Minute
+	}
+	for _, t := range []struct {
+		d   *duration
+		def time.Duration
+	}{
+		{&conf.Timeout.Search, 15 * time.Second},
+		{&conf.Timeout.Stats, 15 * time.Second},
+		{&conf.Timeout.LastUpdate, 30 * time.Second},
+		{&conf.Timeout.Delete, 10 * time.Minute},
+		{&conf.Timeout.Load, 15 * time.Second},
+	} {
+		if t.d.Duration == 0 {
+			t.d.Duration = t.def
+		}
+	}
+	if conf.ResultCache.Size == 0 {
+		conf.ResultCache.Size = 2000
+	}
+	if conf.ResultCache.TTL.Duration == 0 {
+		conf.ResultCache.TTL.Duration = 10 * time.Minute
+	}
+	if conf.Analytics.Retention.Duration == 0 {
+		conf.Analytics.Retention.Duration = 90 * 24 * time.Hour
+	}
+	if err := conf.Ranking.Check(); err != nil {
+		log.Fatalf("invalid ranking in config file: %v", err)
+	}
 	return conf
 }
+
+// LoadRanking reads only the ranking section, so that it can be changed without restart
+func LoadRanking(filepath string) (*search.Ranking, error) {
+	var conf struct {
+		Ranking search.Ranking `toml:"ranking"`
+	}
+	if _, err := toml.DecodeFile(filepath, &conf); err != nil {
+		return nil, err
+	}
+	if err := conf.Ranking.Check(); err != nil {
+		return nil, err
+	}
+	return &conf.Ranking, nil
+}
@@ -19,7 +19,9 @@ package main
 import (
 	"context"
 	"flag"
+	"github.com/bluele/gcache"
 	badger "github.com/dgraph-io/badger/v4"
+	"github.com/je4/utils/v2/pkg/openai"
 	"github.com/je4/utils/v2/pkg/zLogger"
 	"github.com/je4/zsearch/v2/pkg/search"
 	"github.com/rs/zerolog"
@@ -115,70 +117,122 @@ func main() {
 		accesslog = f
 	}
 
-	stat, err := os.Stat(config.CacheDir)
-	if err != nil {
-		logger.Panic().Msgf("cannot stat %s", config.CacheDir)
-		return
-	}
-	if !stat.IsDir() {
-		logger.Panic().Msgf("%s not a director", config.CacheDir)
-		return
-	}
-	if config.ClearCacheOnStartup {
-		logger.Info().Msgf("deleting cache files in %s", config.CacheDir)
-		if len(config.CacheDir) < 4 {
-			logger.Panic().Msgf("%s too short. will not clear cache", config.CacheDir)
-			return
-		}
-		d, err := os.Open(config.CacheDir)
+	var cache search.DocumentCache
+	switch config.CacheBackend {
+	case search.CacheBackendBadger:
+		stat, err := os.Stat(config.CacheDir)
 		if err != nil {
-			logger.Panic().Msgf("cannot open directory %s", config.CacheDir)
+			logger.Panic().Msgf("cannot stat %s", config.CacheDir)
 			return
 		}
-		names, err := d.Readdirnames(-1)
-		if err != nil {
-			d.Close()
-			logger.Panic().Msgf("cannot read %s", config.CacheDir)
+		if !stat.IsDir() {
+			logger.Panic().Msgf("%s not a director", config.CacheDir)
 			return
 		}
-		d.Close()
-		for _, name := range names {
-			fullpath := filepath.Join(config.CacheDir, name)
-			logger.Info().Msgf("delete %s", fullpath)
-			if err := os.Remove(fullpath); err != nil {
-				logger.Panic().Msgf("cannot delete %s", fullpath)
+		if config.ClearCacheOnStartup {
+			logger.Info().Msgf("deleting cache files in %s", config.CacheDir)
+			if len(config.CacheDir) < 4 {
+				logger.Panic().Msgf("%s too short. will not clear cache", config.CacheDir)
+				return
+			}
+			d, err := os.Open(config.CacheDir)
+			if err != nil {
+				logger.Panic().Msgf("cannot open directory %s", config.CacheDir)
 				return
 			}
+			names, err := d.Readdirnames(-1)
+			if err != nil {
+				d.Close()
+				logger.Panic().Msgf("cannot read %s", config.CacheDir)
+				return
+			}
+			d.Close()
+			for _, name := range names {
+				fullpath := filepath.Join(config.CacheDir, name)
+				logger.Info().Msgf("delete %s", fullpath)
+				if err := os.Remove(fullpath); err != nil {
+					logger.Panic().Msgf("cannot delete %s", fullpath)
+					return
+				}
+			}
 		}
-	}
-	/*
-		if err := os.RemoveAll(config.CacheDir); err != nil {
-			logger.Error().Err(err).Msgf("cannot remove %s: %v", config.CacheDir, err)
+		/*
+			if err := os.RemoveAll(config.CacheDir); err != nil {
+				logger.Error().Err(err).Msgf("cannot remove %s: %v", config.CacheDir, err)
+			}
+		*/
+		bconfig := badger.DefaultOptions(config.CacheDir)
+		if runtime.GOOS == "windows" {
+			// bconfig.Truncate = true
 		}
-	*/
-	bconfig := badger.DefaultOptions(config.CacheDir)
-	if runtime.GOOS == "windows" {
-		// bconfig.Truncate = true
-	}
-	//	bconfig.Logger = logger
-	db, err := badger.Open(bconfig)
-	if err != nil {
-		logger.Panic().Msgf("cannot open badger database: %v", err)
+		//	bconfig.Logger = logger
+		db, err := badger.Open(bconfig)
+		if err != nil {
+			logger.Panic().Msgf("cannot open badger database: %v", err)
+			return
+		}
+		defer db.Close()
+		cache = search.NewBadgerCache(db, config.CacheExpiry.Duration)
+	case search.CacheBackendLRU:
+		cache = search.NewLRUCache(config.CacheSize, config.CacheExpiry.Duration)
+	case search.CacheBackendNone:
+		cache = search.NewNoopCache()
+	default:
+		logger.Panic().Msgf("unknown cache backend %s", config.CacheBackend)
 		return
 	}
-	defer db.Close()
 
-	mtElasticWrapper, err := search.NewMTElasticSearch(config.ElasticSearch.Endpoint, config.ElasticSearch.Index, config.ElasticSearch.ApiKey, logger)
-	if err != nil {
-		logger.Panic().Msgf("cannot initialize solr search wrapper: %v", err)
+	var se search.SearchEngine
+	switch config.SearchEngine {
+	case "bleve":
+		mtBleve, err := search.NewMTBleveSearch(config.Bleve.Path, logger)
+		if err != nil {
+			logger.Panic().Msgf("cannot initialize bleve search wrapper: %v", err)
+			return
+		}
+		defer mtBleve.Close()
+		se = mtBleve
+	case "elastic":
+		mtElasticWrapper, err := search.NewMTElasticSearch(config.ElasticSearch.Endpoint, config.ElasticSearch.Index, config.ElasticSearch.ApiKey, logger)
+		if err != nil {
+			logger.Panic().Msgf("cannot initialize elastic search wrapper: %v", err)
+			return
+		}
+		if config.Embedding.OpenaiApiKey != "" {
+			// query embeddings are cached in memory only
+			kv := openai.NewKVGCache(gcache.New(config.Embedding.CacheSize).LRU().Build())
+			mtElasticWrapper.SetEmbedder(search.NewOpenAIEmbedder(openai.NewClientV2(string(config.Embedding.OpenaiApiKey), kv, logger)))
+		}
+		se = mtElasticWrapper
+	default:
+		logger.Panic().Msgf("unknown search engine %s", config.SearchEngine)
 		return
 	}
 
-	searchEngine, err := search.NewSearch(mtElasticWrapper, config.Solr.CacheSize, config.CacheExpiry.Duration, db, logger)
+	searchEngine, err := search.NewSearch(se, cache, logger)
 	if err != nil {
 		logger.Panic().Msgf("cannot initialize solr search engine: %v", err)
 		return
 	}
+	searchEngine.SetTimeouts(search.Timeouts{
+		Search:     config.Timeout.Search.Duration,
+		Stats:      config.Timeout.Stats.Duration,
+		LastUpdate: config.Timeout.LastUpdate.Duration,
+		Delete:     config.Timeout.Delete.Duration,
+		Load:       config.Timeout.Load.Duration,
+	})
+	if config.CacheSweep.Duration > 0 {
+		sweepCtx, sweepCancel := context.WithCancel(context.Background())
+		defer sweepCancel()
+		go searchEngine.Maintain(sweepCtx, config.CacheSweep.Duration)
+	}
+	searchEngine.SetResultCache(config.ResultCache.Size, config.ResultCache.TTL.Duration)
+	if config.CacheWatch.Duration > 0 {
+		// other instances may change the index
+		watchCtx, watchCancel := context.WithCancel(context.Background())
+		defer watchCancel()
+		go searchEngine.WatchUpdates(watchCtx, config.CacheWatch.Duration)
+	}
 
 	uc, err := search.NewUserCache(config.IdleTimeout.Duration, config.UserCacheSize)
 	if err != nil {
@@ -198,6 +252,7 @@ func main() {
 			Field:    facet.Field,
 			Prefix:   facet.Prefix,
 			Restrict: facet.Restrict,
+			Type:     search.FacetType(facet.Type),
 		}
 	}
 
@@ -267,6 +322,33 @@ func main() {
 		logger.Error().Err(err).Msgf("error initializing server: %v", err)
 		return
 	}
+	srv.SetRanking(&config.Ranking)
+	if config.Analytics.Dir != "" {
+		// not in the cache database, which is dropped on clear cache
+		adb, err := badger.Open(badger.DefaultOptions(config.Analytics.Dir))
+		if err != nil {
+			logger.Panic().Msgf("cannot open analytics database %s: %v", config.Analytics.Dir, err)
+			return
+		}
+		defer adb.Close()
+		srv.SetAnalytics(search.NewAnalytics(adb, config.Analytics.Retention.Duration, logger))
+	}
+
+	// curators tune the ranking in the config file, SIGHUP activates it
+	go func() {
+		sighup := make(chan os.Signal, 1)
+		signal.Notify(sighup, syscall.SIGHUP)
+		for range sighup {
+			ranking, err := LoadRanking(*cfgfile)
+			if err != nil {
+				logger.Error().Msgf("cannot reload ranking from %s: %v", *cfgfile, err)
+				continue
+			}
+			srv.SetRanking(ranking)
+			logger.Info().Msgf("ranking reloaded from %s", *cfgfile)
+		}
+	}()
+
 	go func() {
 		if err := srv.ListenAndServe(config.CertPEM, config.KeyPEM); err != nil {
 			logger.Fatal().Msgf("server died: %v", err)
@@ -0,0 +1,80 @@
+/*
+Copyright 2020 Center for Digital Matter HGK FHNW, Basel.
+Copyright 2020 info-age GmbH, Basel.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS-IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"github.com/BurntSushi/toml"
+	"github.com/je4/zsearch/v2/configdata"
+	"github.com/je4/zsearch/v2/pkg/search"
+	"log"
+)
+
+type Cfg_Bleve struct {
+	Path string `toml:"path"`
+}
+
+// Variant is a ranking which is evaluated, lang is the query language ("" searches without language fields)
+type Variant struct {
+	Name    string         `toml:"name"`
+	Lang    string         `toml:"lang"`
+	Ranking search.Ranking `toml:"ranking"`
+}
+
+type Config struct {
+	Logfile       string                      `toml:"logfile"`
+	Loglevel      string                      `toml:"loglevel"`
+	SearchEngine  string                      `toml:"searchengine"`
+	ElasticSearch configdata.CfgElasticSearch `toml:"elasticsearch"`
+	Bleve         Cfg_Bleve                   `toml:"bleve"`
+	Judgments     string                      `toml:"judgments"`
+	// number of hits which are evaluated
+	K int `toml:"k"`
+	// minimal grade of a relevant hit for MRR and precision
+	RelevantGrade int                 `toml:"relevantgrade"`
+	Groups        []string            `toml:"groups"`
+	Filters       map[string][]string `toml:"filter"`
+	Variants      []Variant           `toml:"variant"`
+}
+
+func LoadConfig(filepath string) Config {
+	var conf Config
+	_, err := toml.DecodeFile(filepath, &conf)
+	if err != nil {
+		log.Fatalln("Error on loading config: ", err)
+	}
+	if conf.SearchEngine == "" {
+		conf.SearchEngine = "elastic"
+	}
+	if conf.K <= 0 {
+		conf.K = 10
+	}
+	if conf.RelevantGrade <= 0 {
+		conf.RelevantGrade = 1
+	}
+	if len(conf.Groups) == 0 {
+		conf.Groups = []string{"global/guest"}
+	}
+	if len(conf.Variants) == 0 {
+		conf.Variants = []Variant{{Name: "default", Ranking: *search.DefaultRanking()}}
+	}
+	for _, v := range conf.Variants {
+		if err := v.Ranking.Check(); err != nil {
+			log.Fatalf("invalid ranking in variant %s: %v", v.Name, err)
+		}
+	}
+	return conf
+}
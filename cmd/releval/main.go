@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/je4/zsearch/v2/pkg/search"
+	"github.com/rs/zerolog"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+type queryResult struct {
+	query     string
+	ndcg      float64
+	rr        float64
+	precision float64
+}
+
+func main() {
+	cfgfile := flag.String("cfg", "./releval.toml", "locations of config file")
+	judgmentsfile := flag.String("judgments", "", "judgment file, overrides the config")
+	verbose := flag.Bool("verbose", false, "show the metrics of every query")
+	flag.Parse()
+	config := LoadConfig(*cfgfile)
+	if *judgmentsfile != "" {
+		config.Judgments = *judgmentsfile
+	}
+
+	var out io.Writer = os.Stderr
+	if config.Logfile != "" {
+		fp, err := os.OpenFile(config.Logfile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			log.Fatalf("cannot open logfile %s: %v", config.Logfile, err)
+		}
+		defer fp.Close()
+		out = fp
+	}
+
+	output := zerolog.ConsoleWriter{Out: out, TimeFormat: time.RFC3339}
+	_logger := zerolog.New(output).With().Timestamp().Logger()
+	_logger.Level(zLogger.LogLevel(config.Loglevel))
+	var logger zLogger.ZLogger = &_logger
+
+	fp, err := os.Open(config.Judgments)
+	if err != nil {
+		logger.Fatal().Msgf("cannot open judgments %s: %v", config.Judgments, err)
+	}
+	judgments, err := ReadJudgments(fp)
+	fp.Close()
+	if err != nil {
+		logger.Fatal().Msgf("cannot read judgments %s: %v", config.Judgments, err)
+	}
+	if len(judgments) == 0 {
+		logger.Fatal().Msgf("no judgments in %s", config.Judgments)
+	}
+
+	var se search.SearchEngine
+	switch config.SearchEngine {
+	case "elastic":
+		se, err = search.NewMTElasticSearch(config.ElasticSearch.Endpoint, config.ElasticSearch.Index, string(config.ElasticSearch.ApiKey), logger)
+	case "bleve":
+		se, err = search.NewMTBleveSearch(config.Bleve.Path, logger)
+	default:
+		logger.Fatal().Msgf("unknown search engine %s", config.SearchEngine)
+	}
+	if err != nil {
+		logger.Fatal().Msgf("cannot create %s search engine: %v", config.SearchEngine, err)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "variant\tquery\tnDCG@%d\tMRR\tP@%d\n", config.K, config.K)
+	for _, variant := range config.Variants {
+		ranking := variant.Ranking
+		se.SetRanking(&ranking)
+		results := []queryResult{}
+		for _, query := range judgments.Queries() {
+			_, docs, _, _, _, err := se.SearchContext(context.Background(), &search.SearchConfig{
+				Fields:         map[string][]string{},
+				QStr:           query,
+				FiltersFields:  config.Filters,
+				Groups:         config.Groups,
+				ContentVisible: true,
+				Rows:           config.K,
+				Mode:           search.SearchModeLexical,
+				Lang:           variant.Lang,
+			})
+			if err != nil {
+				logger.Fatal().Msgf("variant %s: cannot search '%s': %v", variant.Name, query, err)
+			}
+			hits := []string{}
+			for _, doc := range docs {
+				hits = append(hits, doc.Signature)
+			}
+			grades := judgments[query]
+			results = append(results, queryResult{
+				query:     query,
+				ndcg:      NDCG(hits, grades, config.K),
+				rr:        ReciprocalRank(hits, grades, config.K, config.RelevantGrade),
+				precision: Precision(hits, grades, config.K, config.RelevantGrade),
+			})
+		}
+		var mean queryResult
+		for _, r := range results {
+			if *verbose {
+				fmt.Fprintf(tw, "%s\t%s\t%.4f\t%.4f\t%.4f\n", variant.Name, r.query, r.ndcg, r.rr, r.precision)
+			}
+			mean.ndcg += r.ndcg / float64(len(results))
+			mean.rr += r.rr / float64(len(results))
+			mean.precision += r.precision / float64(len(results))
+		}
+		fmt.Fprintf(tw, "%s\t(mean of %d)\t%.4f\t%.4f\t%.4f\n", variant.Name, len(results), mean.ndcg, mean.rr, mean.precision)
+	}
+	tw.Flush()
+}
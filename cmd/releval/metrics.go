@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Judgments maps the queries to the graded signatures, signatures without judgment have grade 0
+type Judgments map[string]map[string]int
+
+/*
+ReadJudgments reads the tab separated lines "<query>\t<signature>\t<grade>".
+empty lines and lines starting with # are ignored
+*/
+func ReadJudgments(r io.Reader) (Judgments, error) {
+	judgments := Judgments{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		parts := strings.Split(text, "\t")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("line %d: expected <query>\\t<signature>\\t<grade>, got '%s'", line, text)
+		}
+		grade, err := strconv.Atoi(strings.TrimSpace(parts[2]))
+		if err != nil || grade < 0 {
+			return nil, fmt.Errorf("line %d: invalid grade '%s'", line, parts[2])
+		}
+		query := strings.TrimSpace(parts[0])
+		if _, ok := judgments[query]; !ok {
+			judgments[query] = map[string]int{}
+		}
+		judgments[query][strings.TrimSpace(parts[1])] = grade
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return judgments, nil
+}
+
+// Queries returns the queries in alphabetical order
+func (j Judgments) Queries() []string {
+	queries := []string{}
+	for query := range j {
+		queries = append(queries, query)
+	}
+	sort.Strings(queries)
+	return queries
+}
+
+func dcg(grades []int) float64 {
+	var result float64
+	for i, grade := range grades {
+		result += (math.Pow(2, float64(grade)) - 1) / math.Log2(float64(i+2))
+	}
+	return result
+}
+
+// NDCG is the discounted cumulative gain of the first k hits relative to the best possible ranking of the judgments
+func NDCG(hits []string, grades map[string]int, k int) float64 {
+	actual := []int{}
+	for i := 0; i < len(hits) && i < k; i++ {
+		actual = append(actual, grades[hits[i]])
+	}
+	ideal := []int{}
+	for _, grade := range grades {
+		ideal = append(ideal, grade)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(ideal)))
+	if len(ideal) > k {
+		ideal = ideal[:k]
+	}
+	idcg := dcg(ideal)
+	if idcg == 0 {
+		return 0
+	}
+	return dcg(actual) / idcg
+}
+
+// ReciprocalRank is 1/rank of the first relevant hit, 0 if there is none in the first k hits
+func ReciprocalRank(hits []string, grades map[string]int, k, relevant int) float64 {
+	for i := 0; i < len(hits) && i < k; i++ {
+		if grades[hits[i]] >= relevant {
+			return 1 / float64(i+1)
+		}
+	}
+	return 0
+}
+
+// Precision is the share of relevant hits of the first k positions, missing hits count as not relevant
+func Precision(hits []string, grades map[string]int, k, relevant int) float64 {
+	if k <= 0 {
+		return 0
+	}
+	found := 0
+	for i := 0; i < len(hits) && i < k; i++ {
+		if grades[hits[i]] >= relevant {
+			found++
+		}
+	}
+	return float64(found) / float64(k)
+}
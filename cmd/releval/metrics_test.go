@@ -0,0 +1,42 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	judgments, err := ReadJudgments(strings.NewReader("# query\tsignature\tgrade\nkunst\ta\t3\nkunst\tb\t1\nkunst\tc\t0\n\nmode\td\t2\n"))
+	if err != nil {
+		t.Fatalf("cannot read judgments: %v", err)
+	}
+	if len(judgments) != 2 || len(judgments["kunst"]) != 3 {
+		t.Fatalf("unexpected judgments %v", judgments)
+	}
+	grades := judgments["kunst"]
+
+	if ndcg := NDCG([]string{"a", "b", "x"}, grades, 3); math.Abs(ndcg-1) > 1e-9 {
+		t.Errorf("ideal ranking: nDCG %v != 1", ndcg)
+	}
+	// dcg = 1/log2(2) + 7/log2(4), idcg = 7/log2(2) + 1/log2(3)
+	want := (1 + 7.0/2) / (7 + 1/math.Log2(3))
+	if ndcg := NDCG([]string{"b", "x", "a"}, grades, 3); math.Abs(ndcg-want) > 1e-9 {
+		t.Errorf("nDCG %v != %v", ndcg, want)
+	}
+	if ndcg := NDCG([]string{"x"}, map[string]int{"c": 0}, 3); ndcg != 0 {
+		t.Errorf("nDCG without relevant documents %v != 0", ndcg)
+	}
+	if rr := ReciprocalRank([]string{"x", "c", "b"}, grades, 3, 1); rr != 1.0/3 {
+		t.Errorf("reciprocal rank %v != 1/3", rr)
+	}
+	if rr := ReciprocalRank([]string{"x", "c", "b"}, grades, 2, 1); rr != 0 {
+		t.Errorf("reciprocal rank beyond k %v != 0", rr)
+	}
+	if p := Precision([]string{"a", "c"}, grades, 4, 1); p != 0.25 {
+		t.Errorf("precision %v != 0.25", p)
+	}
+	if _, err := ReadJudgments(strings.NewReader("kunst\ta\n")); err == nil {
+		t.Errorf("missing grade not detected")
+	}
+}
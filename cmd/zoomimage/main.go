@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"emperror.dev/emperror"
 	"emperror.dev/errors"
 	"encoding/json"
@@ -74,7 +75,7 @@ func main() {
 	var width int64
 	var cHeight = config.CHeight
 
-	if err := mte.Scroll(scrollConfig, func(data *search.SourceData) error {
+	if err := mte.Scroll(context.Background(), scrollConfig, func(data *search.SourceData) error {
 		if data.HasMedia == false {
 			return nil
 		}
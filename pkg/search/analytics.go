@@ -0,0 +1,258 @@
+package search
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/bluele/gcache"
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// the time in the keys makes a time window a range scan
+const (
+	analyticsSearchPrefix = "search/"
+	analyticsClickPrefix  = "click/"
+)
+
+// SearchEvent is a search of the first result page, nothing about the user is stored
+type SearchEvent struct {
+	Time    time.Time           `json:"time"`
+	Query   string              `json:"query"`
+	Filters map[string][]string `json:"filters,omitempty"`
+	Mode    string              `json:"mode,omitempty"`
+	// -1 if unknown
+	Total int64 `json:"total"`
+}
+
+// ClickEvent is the opening of a detail page from a search result
+type ClickEvent struct {
+	Time      time.Time `json:"time"`
+	Query     string    `json:"query"`
+	Signature string    `json:"signature"`
+}
+
+type QueryStat struct {
+	Query    string `json:"query"`
+	Searches int64  `json:"searches"`
+	ZeroHits int64  `json:"zerohits"`
+	Clicks   int64  `json:"clicks"`
+	// clicks per search
+	ClickThrough float64 `json:"clickthrough"`
+	// number of hits of the last search
+	Total int64 `json:"total"`
+	last  time.Time
+}
+
+type SignatureStat struct {
+	Signature string `json:"signature"`
+	Clicks    int64  `json:"clicks"`
+}
+
+type AnalyticsReport struct {
+	From         time.Time       `json:"from"`
+	To           time.Time       `json:"to"`
+	Searches     int64           `json:"searches"`
+	ZeroHits     int64           `json:"zerohits"`
+	Clicks       int64           `json:"clicks"`
+	ClickThrough float64         `json:"clickthrough"`
+	TopQueries   []QueryStat     `json:"topqueries"`
+	ZeroResults  []QueryStat     `json:"zeroresults"`
+	TopClicks    []SignatureStat `json:"topclicks"`
+}
+
+/*
+Analytics records searches and clicks in a badger database.
+events expire after the retention time
+*/
+type Analytics struct {
+	db        *badger.DB
+	retention time.Duration
+	// total of the searches which are served from the result cache
+	totals gcache.Cache
+	seq    atomic.Uint64
+	log    zLogger.ZLogger
+}
+
+func NewAnalytics(db *badger.DB, retention time.Duration, log zLogger.ZLogger) *Analytics {
+	return &Analytics{
+		db:        db,
+		retention: retention,
+		totals:    gcache.New(5000).LRU().Build(),
+		log:       log,
+	}
+}
+
+// NormalizeQuery makes the spellings of a query comparable
+func NormalizeQuery(query string) string {
+	return strings.ToLower(strings.Join(strings.Fields(query), " "))
+}
+
+func analyticsKey(prefix string, t time.Time, seq uint64) []byte {
+	return []byte(fmt.Sprintf("%s%020d/%d", prefix, t.UnixNano(), seq))
+}
+
+func (a *Analytics) put(prefix string, t time.Time, event interface{}) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrapf(err, "cannot marshal %s event", strings.TrimSuffix(prefix, "/"))
+	}
+	entry := badger.NewEntry(analyticsKey(prefix, t, a.seq.Add(1)), data)
+	if a.retention > 0 {
+		entry = entry.WithTTL(a.retention)
+	}
+	return a.db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(entry)
+	})
+}
+
+/*
+AddSearch stores a search. key identifies identical searches:
+if the total is unknown because the result comes from a cache, the total of the last search with this key is used
+*/
+func (a *Analytics) AddSearch(key string, event *SearchEvent) error {
+	if event.Total < 0 {
+		if total, err := a.totals.Get(key); err == nil {
+			event.Total = total.(int64)
+		}
+	} else {
+		_ = a.totals.Set(key, event.Total)
+	}
+	event.Query = NormalizeQuery(event.Query)
+	return a.put(analyticsSearchPrefix, event.Time, event)
+}
+
+func (a *Analytics) AddClick(event *ClickEvent) error {
+	event.Query = NormalizeQuery(event.Query)
+	return a.put(analyticsClickPrefix, event.Time, event)
+}
+
+// scan calls f with the values of the events between from (inclusive) and to (exclusive)
+func (a *Analytics) scan(prefix string, from, to time.Time, f func(val []byte) error) error {
+	end := analyticsKey(prefix, to, 0)
+	return a.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(prefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Seek(analyticsKey(prefix, from, 0)); it.ValidForPrefix(opts.Prefix); it.Next() {
+			if bytes.Compare(it.Item().Key(), end) >= 0 {
+				break
+			}
+			if err := it.Item().Value(f); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+/*
+Report aggregates the events between from and to.
+the lists contain at most limit entries, searches without query text are only part of the totals
+*/
+func (a *Analytics) Report(from, to time.Time, limit int) (*AnalyticsReport, error) {
+	report := &AnalyticsReport{
+		From:        from,
+		To:          to,
+		TopQueries:  []QueryStat{},
+		ZeroResults: []QueryStat{},
+		TopClicks:   []SignatureStat{},
+	}
+	queries := map[string]*QueryStat{}
+	stat := func(query string) *QueryStat {
+		qs, ok := queries[query]
+		if !ok {
+			qs = &QueryStat{Query: query, Total: -1}
+			queries[query] = qs
+		}
+		return qs
+	}
+	if err := a.scan(analyticsSearchPrefix, from, to, func(val []byte) error {
+		event := &SearchEvent{}
+		if err := json.Unmarshal(val, event); err != nil {
+			return errors.Wrapf(err, "cannot unmarshal search event %s", string(val))
+		}
+		report.Searches++
+		qs := stat(event.Query)
+		qs.Searches++
+		if event.Total == 0 {
+			report.ZeroHits++
+			qs.ZeroHits++
+		}
+		if event.Total >= 0 && !event.Time.Before(qs.last) {
+			qs.Total = event.Total
+			qs.last = event.Time
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "cannot read search events")
+	}
+	signatures := map[string]int64{}
+	if err := a.scan(analyticsClickPrefix, from, to, func(val []byte) error {
+		event := &ClickEvent{}
+		if err := json.Unmarshal(val, event); err != nil {
+			return errors.Wrapf(err, "cannot unmarshal click event %s", string(val))
+		}
+		report.Clicks++
+		stat(event.Query).Clicks++
+		signatures[event.Signature]++
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "cannot read click events")
+	}
+
+	if report.Searches > 0 {
+		report.ClickThrough = float64(report.Clicks) / float64(report.Searches)
+	}
+	for query, qs := range queries {
+		if query == "" {
+			continue
+		}
+		// clicks from searches before the time window
+		if qs.Searches == 0 {
+			continue
+		}
+		qs.ClickThrough = float64(qs.Clicks) / float64(qs.Searches)
+		report.TopQueries = append(report.TopQueries, *qs)
+		if qs.ZeroHits > 0 {
+			report.ZeroResults = append(report.ZeroResults, *qs)
+		}
+	}
+	sort.Slice(report.TopQueries, func(i, j int) bool {
+		if report.TopQueries[i].Searches != report.TopQueries[j].Searches {
+			return report.TopQueries[i].Searches > report.TopQueries[j].Searches
+		}
+		return report.TopQueries[i].Query < report.TopQueries[j].Query
+	})
+	sort.Slice(report.ZeroResults, func(i, j int) bool {
+		if report.ZeroResults[i].ZeroHits != report.ZeroResults[j].ZeroHits {
+			return report.ZeroResults[i].ZeroHits > report.ZeroResults[j].ZeroHits
+		}
+		return report.ZeroResults[i].Query < report.ZeroResults[j].Query
+	})
+	for signature, clicks := range signatures {
+		report.TopClicks = append(report.TopClicks, SignatureStat{Signature: signature, Clicks: clicks})
+	}
+	sort.Slice(report.TopClicks, func(i, j int) bool {
+		if report.TopClicks[i].Clicks != report.TopClicks[j].Clicks {
+			return report.TopClicks[i].Clicks > report.TopClicks[j].Clicks
+		}
+		return report.TopClicks[i].Signature < report.TopClicks[j].Signature
+	})
+	if len(report.TopQueries) > limit {
+		report.TopQueries = report.TopQueries[:limit]
+	}
+	if len(report.ZeroResults) > limit {
+		report.ZeroResults = report.ZeroResults[:limit]
+	}
+	if len(report.TopClicks) > limit {
+		report.TopClicks = report.TopClicks[:limit]
+	}
+	return report, nil
+}
@@ -0,0 +1,64 @@
+package search
+
+import (
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/rs/zerolog"
+	"testing"
+	"time"
+)
+
+func TestAnalyticsReport(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatalf("cannot open badger: %v", err)
+	}
+	defer db.Close()
+	logger := zerolog.Nop()
+	a := NewAnalytics(db, time.Hour, &logger)
+
+	now := time.Now()
+	for _, ev := range []struct {
+		key   string
+		query string
+		total int64
+		time  time.Time
+	}{
+		{"k1", "Kunst", 12, now},
+		{"k1", " kunst ", -1, now},
+		{"k2", "kunst  raum", 3, now},
+		{"k3", "kunzt", 0, now},
+		{"k3", "kunzt", -1, now},
+		{"k4", "", 100, now},
+		{"k5", "old", 0, now.Add(-48 * time.Hour)},
+	} {
+		if err := a.AddSearch(ev.key, &SearchEvent{Time: ev.time, Query: ev.query, Total: ev.total}); err != nil {
+			t.Fatalf("cannot add search: %v", err)
+		}
+	}
+	for _, sig := range []string{"a", "b", "a"} {
+		if err := a.AddClick(&ClickEvent{Time: now, Query: "KUNST", Signature: sig}); err != nil {
+			t.Fatalf("cannot add click: %v", err)
+		}
+	}
+
+	report, err := a.Report(now.Add(-time.Hour), now.Add(time.Second), 2)
+	if err != nil {
+		t.Fatalf("cannot create report: %v", err)
+	}
+	if report.Searches != 6 || report.ZeroHits != 2 || report.Clicks != 3 {
+		t.Errorf("wrong totals: %d searches, %d zero hits, %d clicks", report.Searches, report.ZeroHits, report.Clicks)
+	}
+	if len(report.TopQueries) != 2 || report.TopQueries[0].Query != "kunst" || report.TopQueries[0].Searches != 2 {
+		t.Fatalf("wrong top queries %v", report.TopQueries)
+	}
+	if report.TopQueries[0].ClickThrough != 1.5 || report.TopQueries[0].Total != 12 {
+		t.Errorf("wrong statistics of kunst %+v", report.TopQueries[0])
+	}
+	// the cached search got the total of the first one
+	if len(report.ZeroResults) != 1 || report.ZeroResults[0].Query != "kunzt" || report.ZeroResults[0].ZeroHits != 2 {
+		t.Errorf("wrong zero results %v", report.ZeroResults)
+	}
+	if len(report.TopClicks) != 2 || report.TopClicks[0].Signature != "a" || report.TopClicks[0].Clicks != 2 {
+		t.Errorf("wrong top clicks %v", report.TopClicks)
+	}
+}
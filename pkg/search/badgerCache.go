@@ -0,0 +1,171 @@
+package search
+
+import (
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"time"
+)
+
+type cacheStruct struct {
+	Src       SourceData
+	Timestamp time.Time
+}
+
+/*
+BadgerCache stores the documents compressed in a badger database.
+the entries expire with the ttl of badger, the value log is reclaimed by Sweep
+*/
+type BadgerCache struct {
+	db       *badger.DB
+	expiry   time.Duration
+	counters cacheCounters
+}
+
+func NewBadgerCache(db *badger.DB, expiry time.Duration) *BadgerCache {
+	return &BadgerCache{
+		db:     db,
+		expiry: expiry,
+	}
+}
+
+func (bc *BadgerCache) Get(signature string) (*SourceData, time.Time, error) {
+	var doc = &cacheStruct{}
+	if err := bc.db.View(func(txn *badger.Txn) error {
+		it, err := txn.Get([]byte(signature))
+		if err != nil {
+			return err
+		}
+		return it.Value(func(v []byte) error {
+			// decompress...
+			data, err := Decompress(v)
+			if err != nil {
+				return errors.Wrapf(err, "cannot decompress %s", signature)
+			}
+			// ...unmarshal
+			if err := bson.Unmarshal(data, doc); err != nil {
+				return errors.Wrapf(err, "cannot unmarshal %s", signature)
+			}
+			return nil
+		})
+	}); err != nil {
+		bc.counters.misses.Add(1)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, time.Time{}, ErrCacheMiss
+		}
+		return nil, time.Time{}, errors.Wrapf(err, "cannot load %s from cache", signature)
+	}
+	// entries without ttl of former versions
+	if bc.expiry > 0 && time.Now().After(doc.Timestamp.Add(bc.expiry)) {
+		bc.counters.misses.Add(1)
+		bc.counters.expired.Add(1)
+		return nil, time.Time{}, ErrCacheMiss
+	}
+	bc.counters.hits.Add(1)
+	return &doc.Src, doc.Timestamp, nil
+}
+
+func (bc *BadgerCache) Set(src *SourceData) error {
+	data, err := bson.Marshal(cacheStruct{
+		Src:       *src,
+		Timestamp: time.Now(),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "cannot marshal source data of %v", src.Signature)
+	}
+	entry := badger.NewEntry([]byte(src.Signature), Compress(data))
+	if bc.expiry > 0 {
+		entry = entry.WithTTL(bc.expiry)
+	}
+	return bc.db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(entry)
+	})
+}
+
+func (bc *BadgerCache) Delete(signatures ...string) error {
+	return bc.db.Update(func(txn *badger.Txn) error {
+		for _, signature := range signatures {
+			if err := txn.Delete([]byte(signature)); err != nil {
+				return errors.Wrapf(err, "cannot delete %s", signature)
+			}
+		}
+		return nil
+	})
+}
+
+func (bc *BadgerCache) DeletePrefix(prefix string) error {
+	return bc.db.DropPrefix([]byte(prefix))
+}
+
+func (bc *BadgerCache) Clear() error {
+	return bc.db.DropAll()
+}
+
+/*
+Sweep deletes the expired entries without ttl and runs the garbage collection of the value log.
+without it the cache directory grows forever
+*/
+func (bc *BadgerCache) Sweep() error {
+	var expired [][]byte
+	if bc.expiry > 0 {
+		now := time.Now()
+		if err := bc.db.View(func(txn *badger.Txn) error {
+			it := txn.NewIterator(badger.DefaultIteratorOptions)
+			defer it.Close()
+			for it.Rewind(); it.Valid(); it.Next() {
+				item := it.Item()
+				// badger removes entries with ttl
+				if item.ExpiresAt() > 0 {
+					continue
+				}
+				if err := item.Value(func(v []byte) error {
+					data, err := Decompress(v)
+					if err != nil {
+						return err
+					}
+					var doc = &cacheStruct{}
+					if err := bson.Unmarshal(data, doc); err != nil || now.After(doc.Timestamp.Add(bc.expiry)) {
+						expired = append(expired, item.KeyCopy(nil))
+					}
+					return nil
+				}); err != nil {
+					// broken entries are removed too
+					expired = append(expired, item.KeyCopy(nil))
+				}
+			}
+			return nil
+		}); err != nil {
+			return errors.Wrap(err, "cannot scan cache")
+		}
+	}
+	if len(expired) > 0 {
+		wb := bc.db.NewWriteBatch()
+		defer wb.Cancel()
+		for _, key := range expired {
+			if err := wb.Delete(key); err != nil {
+				return errors.Wrapf(err, "cannot delete %s", string(key))
+			}
+		}
+		if err := wb.Flush(); err != nil {
+			return errors.Wrap(err, "cannot delete expired entries")
+		}
+		bc.counters.expired.Add(int64(len(expired)))
+	}
+	if bc.db.Opts().InMemory {
+		return nil
+	}
+	// one run rewrites at most one file
+	for {
+		if err := bc.db.RunValueLogGC(0.5); err != nil {
+			if errors.Is(err, badger.ErrNoRewrite) || errors.Is(err, badger.ErrRejected) {
+				break
+			}
+			return errors.Wrap(err, "cannot run value log gc")
+		}
+	}
+	return nil
+}
+
+func (bc *BadgerCache) Stats() CacheStats {
+	return bc.counters.stats(CacheBackendBadger, -1)
+}
@@ -0,0 +1,935 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/blevesearch/bleve/v2"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/de"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/en"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/fr"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/it"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/registry"
+	"github.com/blevesearch/bleve/v2/search/highlight"
+	htmlFormatter "github.com/blevesearch/bleve/v2/search/highlight/format/html"
+	simpleFragmenter "github.com/blevesearch/bleve/v2/search/highlight/fragmenter/simple"
+	simpleHighlighter "github.com/blevesearch/bleve/v2/search/highlight/highlighter/simple"
+	"github.com/blevesearch/bleve/v2/search/query"
+	index "github.com/blevesearch/bleve_index_api"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/pkg/errors"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const bleveHighlighter = "zsearch"
+const bleveDefaultFacetSize = 10
+const bleveScrollSize = 1000
+
+// same tags as the elastic highlighter, so templates do not need to care about the engine
+func init() {
+	registry.RegisterFragmentFormatter(bleveHighlighter, func(config map[string]interface{}, cache *registry.Cache) (highlight.FragmentFormatter, error) {
+		return htmlFormatter.NewFragmentFormatter(`<span class="highlight">`, `</span>`), nil
+	})
+	registry.RegisterHighlighter(bleveHighlighter, func(config map[string]interface{}, cache *registry.Cache) (highlight.Highlighter, error) {
+		fragmenter, err := cache.FragmenterNamed(simpleFragmenter.Name)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot build fragmenter")
+		}
+		formatter, err := cache.FragmentFormatterNamed(bleveHighlighter)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot build fragment formatter")
+		}
+		return simpleHighlighter.NewHighlighter(fragmenter, formatter, simpleHighlighter.DefaultSeparator), nil
+	})
+}
+
+type tBleveDocumentPersons struct {
+	Name []string `json:"name"`
+	Role []string `json:"role"`
+}
+
+type tBleveDocumentACL struct {
+	Meta    []string `json:"meta"`
+	Content []string `json:"content"`
+}
+
+type tBleveDocumentPDF struct {
+	Fulltext []string `json:"fulltext"`
+}
+
+type tBleveDocumentMedia struct {
+	PDF tBleveDocumentPDF `json:"pdf"`
+}
+
+/*
+flattened view of SourceData with the field names used by the elastic index.
+the complete SourceData is stored as json in Data
+*/
+type tBleveDocument struct {
+	Signature    string                `json:"signature"`
+	Source       string                `json:"source"`
+	Type         string                `json:"type"`
+	Title        []string              `json:"title"`
+	Abstract     []string              `json:"abstract"`
+	Notes        []string              `json:"notes"`
+	Persons      tBleveDocumentPersons `json:"persons"`
+	ACL          tBleveDocumentACL     `json:"acl"`
+	Catalog      []string              `json:"catalog"`
+	Category     []string              `json:"category"`
+	Tags         []string              `json:"tags"`
+	Mediatype    []string              `json:"mediatype"`
+	Media        tBleveDocumentMedia   `json:"media"`
+	HasMedia     bool                  `json:"hasmedia"`
+	DateAdded    time.Time             `json:"dateadded"`
+	ItemDate     *time.Time            `json:"itemdate,omitempty"`
+	TitleSort    map[string]string     `json:"titlesort,omitempty"`
+	TitleLang    *LangText             `json:"titlelang,omitempty"`
+	AbstractLang *LangText             `json:"abstractlang,omitempty"`
+	Suggest      []string              `json:"suggest"`
+	Timestamp    time.Time             `json:"timestamp"`
+	Data         string                `json:"data"`
+}
+
+func newBleveDocument(source *SourceData) (*tBleveDocument, error) {
+	data, err := json.Marshal(source)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot marshal %s", source.Signature)
+	}
+	doc := &tBleveDocument{
+		Signature:    source.Signature,
+		Source:       source.Source,
+		Type:         source.Type,
+		Title:        []string{},
+		Abstract:     []string{},
+		Notes:        []string{},
+		Persons:      tBleveDocumentPersons{Name: []string{}, Role: []string{}},
+		ACL:          tBleveDocumentACL{Meta: source.ACL["meta"], Content: source.ACL["content"]},
+		Catalog:      source.Catalog,
+		Category:     source.Category,
+		Tags:         source.Tags,
+		Mediatype:    source.Mediatype,
+		Media:        tBleveDocumentMedia{PDF: tBleveDocumentPDF{Fulltext: []string{}}},
+		HasMedia:     source.HasMedia,
+		DateAdded:    source.DateAdded,
+		ItemDate:     source.ItemDate,
+		TitleSort:    source.TitleSort,
+		TitleLang:    source.TitleLang,
+		AbstractLang: source.AbstractLang,
+		Timestamp:    source.Timestamp,
+		Data:         string(data),
+	}
+	if source.Title != nil {
+		for _, lang := range source.Title.GetLanguages() {
+			doc.Title = append(doc.Title, source.Title.Get(lang))
+		}
+	}
+	if source.Abstract != nil {
+		for _, lang := range source.Abstract.GetLanguages() {
+			doc.Abstract = append(doc.Abstract, source.Abstract.Get(lang))
+		}
+	}
+	// tags and categories are keywords, suggest makes their words searchable
+	doc.Suggest = append(doc.Suggest, source.Tags...)
+	for _, cat := range source.Category {
+		if parent := hierarchyParent(cat); parent != "" {
+			cat = cat[len(parent)+len(HierarchySeparator):]
+		}
+		doc.Suggest = append(doc.Suggest, cat)
+	}
+	for _, note := range source.Notes {
+		doc.Notes = append(doc.Notes, string(note.Note))
+	}
+	for _, p := range source.Persons {
+		doc.Persons.Name = append(doc.Persons.Name, p.Name)
+		doc.Persons.Role = append(doc.Persons.Role, p.Role)
+	}
+	for _, pdf := range source.Media["pdf"] {
+		if pdf.Fulltext != "" {
+			doc.Media.PDF.Fulltext = append(doc.Media.PDF.Fulltext, pdf.Fulltext)
+		}
+	}
+	return doc, nil
+}
+
+func bleveTextField() *mapping.FieldMapping {
+	fm := bleve.NewTextFieldMapping()
+	fm.Analyzer = "standard"
+	fm.Store = true
+	fm.IncludeTermVectors = true
+	return fm
+}
+
+func bleveKeywordField() *mapping.FieldMapping {
+	fm := bleve.NewKeywordFieldMapping()
+	fm.Store = false
+	fm.IncludeInAll = false
+	return fm
+}
+
+// the sort languages are analyzed with the bleve analyzer of the same name
+func bleveLangTextMapping() *mapping.DocumentMapping {
+	lt := bleve.NewDocumentStaticMapping()
+	for _, variant := range []string{"native", "translated"} {
+		texts := bleve.NewDocumentStaticMapping()
+		for _, lang := range SortLanguages {
+			base, _ := lang.Base()
+			fm := bleve.NewTextFieldMapping()
+			fm.Analyzer = base.String()
+			fm.Store = false
+			fm.IncludeInAll = false
+			texts.AddFieldMappingsAt(base.String(), fm)
+		}
+		lt.AddSubDocumentMapping(variant, texts)
+	}
+	return lt
+}
+
+func bleveIndexMapping() *mapping.IndexMappingImpl {
+	doc := bleve.NewDocumentStaticMapping()
+	doc.AddFieldMappingsAt("signature", bleveKeywordField())
+	doc.AddFieldMappingsAt("source", bleveKeywordField())
+	doc.AddFieldMappingsAt("type", bleveKeywordField())
+	doc.AddFieldMappingsAt("title", bleveTextField())
+	doc.AddFieldMappingsAt("abstract", bleveTextField())
+	doc.AddFieldMappingsAt("notes", bleveTextField())
+	doc.AddFieldMappingsAt("catalog", bleveKeywordField())
+	doc.AddFieldMappingsAt("category", bleveKeywordField())
+	doc.AddFieldMappingsAt("tags", bleveKeywordField())
+	doc.AddFieldMappingsAt("mediatype", bleveKeywordField())
+	doc.AddFieldMappingsAt("hasmedia", bleve.NewBooleanFieldMapping())
+	doc.AddFieldMappingsAt("dateadded", bleve.NewDateTimeFieldMapping())
+	doc.AddFieldMappingsAt("itemdate", bleve.NewDateTimeFieldMapping())
+	doc.AddFieldMappingsAt("timestamp", bleve.NewDateTimeFieldMapping())
+	suggest := bleveTextField()
+	suggest.Store = false
+	suggest.IncludeInAll = false
+	doc.AddFieldMappingsAt("suggest", suggest)
+
+	data := bleve.NewTextFieldMapping()
+	data.Index = false
+	data.Store = true
+	data.IncludeInAll = false
+	data.IncludeTermVectors = false
+	data.DocValues = false
+	doc.AddFieldMappingsAt("data", data)
+
+	persons := bleve.NewDocumentStaticMapping()
+	personsKeyword := bleveKeywordField()
+	personsKeyword.Name = "name.keyword"
+	persons.AddFieldMappingsAt("name", bleveTextField(), personsKeyword)
+	persons.AddFieldMappingsAt("role", bleveKeywordField())
+	doc.AddSubDocumentMapping("persons", persons)
+
+	titleSort := bleve.NewDocumentStaticMapping()
+	for _, lang := range SortLanguages {
+		base, _ := lang.Base()
+		titleSort.AddFieldMappingsAt(base.String(), bleveKeywordField())
+	}
+	doc.AddSubDocumentMapping("titlesort", titleSort)
+	doc.AddSubDocumentMapping("titlelang", bleveLangTextMapping())
+	doc.AddSubDocumentMapping("abstractlang", bleveLangTextMapping())
+
+	acl := bleve.NewDocumentStaticMapping()
+	acl.AddFieldMappingsAt("meta", bleveKeywordField())
+	acl.AddFieldMappingsAt("content", bleveKeywordField())
+	doc.AddSubDocumentMapping("acl", acl)
+
+	pdf := bleve.NewDocumentStaticMapping()
+	pdf.AddFieldMappingsAt("fulltext", bleveTextField())
+	media := bleve.NewDocumentStaticMapping()
+	media.AddSubDocumentMapping("pdf", pdf)
+	doc.AddSubDocumentMapping("media", media)
+
+	im := bleve.NewIndexMapping()
+	im.DefaultMapping = doc
+	im.DefaultAnalyzer = "standard"
+	return im
+}
+
+// bleve has no keyword subfields, text fields which need one get an explicit ".keyword" mapping
+func bleveKeywordFieldName(field string) string {
+	field = strings.TrimSuffix(field, ".keyword")
+	switch field {
+	case "persons.name":
+		return field + ".keyword"
+	}
+	return field
+}
+
+/*
+MTBleveSearch is an embedded SearchEngine which does not need an elastic cluster
+*/
+type MTBleveSearch struct {
+	index   bleve.Index
+	ranking atomic.Pointer[Ranking]
+	log     zLogger.ZLogger
+}
+
+// ErrOutdatedMapping is returned for a bleve index of an older version, it must be deleted and indexed again
+var ErrOutdatedMapping = errors.New("bleve index has an outdated mapping, delete it and index the documents again")
+
+/*
+NewMTBleveSearch opens the index at path or creates it.
+the mapping of an existing index cannot be changed, so an index with another mapping fails with ErrOutdatedMapping
+*/
+func NewMTBleveSearch(path string, log zLogger.ZLogger) (*MTBleveSearch, error) {
+	var index bleve.Index
+	var err error
+	if _, statErr := os.Stat(path); statErr == nil {
+		index, err = bleve.Open(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot open bleve index %s", path)
+		}
+		if err := bleveCheckMapping(index); err != nil {
+			index.Close()
+			return nil, errors.Wrapf(err, "cannot open bleve index %s", path)
+		}
+	} else {
+		index, err = bleve.New(path, bleveIndexMapping())
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot create bleve index %s", path)
+		}
+	}
+	mbs := &MTBleveSearch{
+		index: index,
+		log:   log,
+	}
+	mbs.ranking.Store(DefaultRanking())
+	return mbs, nil
+}
+
+// bleveCheckMapping compares the stored mapping of the index with the mapping of this version
+func bleveCheckMapping(index bleve.Index) error {
+	stored, err := json.Marshal(index.Mapping())
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal stored mapping")
+	}
+	current, err := json.Marshal(bleveIndexMapping())
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal mapping")
+	}
+	if string(stored) != string(current) {
+		return ErrOutdatedMapping
+	}
+	return nil
+}
+
+// SetRanking replaces the weights of the relevance search, it can be called while searching
+func (mbs *MTBleveSearch) SetRanking(r *Ranking) {
+	mbs.ranking.Store(r)
+}
+
+func (mbs *MTBleveSearch) Close() error {
+	return mbs.index.Close()
+}
+
+func (mbs *MTBleveSearch) Update(source *SourceData) error {
+	return mbs.UpdateTimestamp(source, time.Now())
+}
+
+func (mbs *MTBleveSearch) UpdateTimestamp(source *SourceData, timestamp time.Time) error {
+	source.Timestamp = timestamp
+	source.ItemDate = normalizeItemDate(source.Date)
+	source.TitleSort = titleSortKeys(source.Title)
+	source.TitleLang = newLangText(source.Title)
+	source.AbstractLang = newLangText(source.Abstract)
+	doc, err := newBleveDocument(source)
+	if err != nil {
+		return err
+	}
+	if err := mbs.index.Index(source.GetSignature(), doc); err != nil {
+		return errors.Wrapf(err, "cannot index document ID=%v", source.GetSignature())
+	}
+	return nil
+}
+
+func (mbs *MTBleveSearch) LoadDocs(ids []string, ctx context.Context) (map[string]*SourceData, error) {
+	result := make(map[string]*SourceData)
+	if len(ids) == 0 {
+		return result, nil
+	}
+	req := bleve.NewSearchRequestOptions(bleve.NewDocIDQuery(ids), len(ids), 0, false)
+	req.Fields = []string{"data"}
+	res, err := mbs.index.SearchInContext(ctx, req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot load documents %v", ids)
+	}
+	for _, hit := range res.Hits {
+		sd, err := bleveHitSource(hit.Fields)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot decode document %s", hit.ID)
+		}
+		result[hit.ID] = sd
+	}
+	return result, nil
+}
+
+func bleveHitSource(fields map[string]interface{}) (*SourceData, error) {
+	data, ok := fields["data"].(string)
+	if !ok {
+		return nil, fmt.Errorf("no stored data")
+	}
+	var sd = &SourceData{}
+	if err := json.Unmarshal([]byte(data), sd); err != nil {
+		return nil, errors.Wrap(err, "cannot unmarshal stored data")
+	}
+	return sd, nil
+}
+
+func bleveTermsQuery(field string, values ...string) query.Query {
+	queries := []query.Query{}
+	for _, val := range values {
+		tq := bleve.NewTermQuery(val)
+		tq.SetField(field)
+		queries = append(queries, tq)
+	}
+	return bleve.NewDisjunctionQuery(queries...)
+}
+
+func bleveFilterQuery(fld, val string) query.Query {
+	switch fld {
+	case "category":
+		pq := bleve.NewPrefixQuery(val)
+		pq.SetField(fld)
+		return pq
+	case "persons.name":
+		return bleveTermsQuery(bleveKeywordFieldName(fld), val)
+	default:
+		if strings.HasSuffix(val, "*") {
+			pq := bleve.NewPrefixQuery(strings.TrimRight(val, "*"))
+			pq.SetField(fld)
+			return pq
+		}
+		return bleveTermsQuery(bleveKeywordFieldName(fld), val)
+	}
+}
+
+/*
+builds the acl and field filters the same way MTElasticSearch does.
+orFilters combines the field filters with OR (like Scroll), otherwise all of them must match
+*/
+func bleveFilters(groups []string, isAdmin, contentVisible bool, filtersFields map[string][]string, orFilters bool) []query.Query {
+	filters := []query.Query{}
+	if !isAdmin && len(groups) > 0 {
+		filters = append(filters, bleveTermsQuery("acl.meta", groups...))
+	}
+	if contentVisible {
+		if len(groups) > 0 && !isAdmin {
+			filters = append(filters, bleveTermsQuery("acl.content", groups...))
+		}
+		hasMedia := bleve.NewBoolFieldQuery(true)
+		hasMedia.SetField("hasmedia")
+		filters = append(filters, hasMedia)
+	}
+	fieldFilters := []query.Query{}
+	for fld, vals := range filtersFields {
+		for _, val := range vals {
+			fieldFilters = append(fieldFilters, bleveFilterQuery(fld, val))
+		}
+	}
+	if len(fieldFilters) > 0 {
+		if orFilters {
+			filters = append(filters, bleve.NewDisjunctionQuery(fieldFilters...))
+		} else {
+			filters = append(filters, fieldFilters...)
+		}
+	}
+	return filters
+}
+
+/*
+bleveMatchQuery compiles the search box query with bleveQueryFromNode.
+nil if nothing is searched
+*/
+func bleveMatchQuery(qstr, lang string, r *Ranking) query.Query {
+	if qstr == "" {
+		return nil
+	}
+	node, err := ParseQuery(qstr, nil)
+	if err != nil {
+		// the server checks the syntax, search for the words only
+		words := &QueryBoolNode{}
+		for _, word := range wordsRegexp.FindAllString(qstr, -1) {
+			words.Children = append(words.Children, &QueryTermNode{Value: word})
+		}
+		node = words
+	}
+	if node == nil {
+		return nil
+	}
+	return bleveQueryFromNode(node, lang, r)
+}
+
+/*
+bleveRanking adds the factors of the ranking to bq.
+bleve cannot multiply scores: instead of punishing documents without media the ones with media get a bonus,
+catalogs and media types with a factor above 1 get a bonus, the recency decay is not supported
+*/
+func bleveRanking(bq *query.BooleanQuery, r *Ranking) {
+	if noMedia := r.noMedia(); noMedia < 1 {
+		hasMedia := bleve.NewBoolFieldQuery(true)
+		hasMedia.SetField("hasmedia")
+		hasMedia.SetBoost(1 - noMedia)
+		bq.AddShould(hasMedia)
+	}
+	for fld, factors := range map[string]map[string]float64{"catalog": r.Catalog, "mediatype": r.Mediatype} {
+		for val, factor := range factors {
+			if factor <= 1 {
+				continue
+			}
+			tq := bleve.NewTermQuery(val)
+			tq.SetField(fld)
+			tq.SetBoost(factor - 1)
+			bq.AddShould(tq)
+		}
+	}
+}
+
+// bleveDateRangeQuery creates a range query with zero times as open bounds, to is exclusive
+func bleveDateRangeQuery(field string, from, to time.Time) query.Query {
+	inclusive, exclusive := true, false
+	drq := bleve.NewDateRangeInclusiveQuery(from, to, &inclusive, &exclusive)
+	drq.SetField(field)
+	return drq
+}
+
+func bleveQuery(match query.Query, filters []query.Query) query.Query {
+	bq := bleve.NewBooleanQuery()
+	if match != nil {
+		bq.AddMust(match)
+	}
+	if len(filters) > 0 {
+		bq.AddMust(filters...)
+	}
+	if match == nil && len(filters) == 0 {
+		bq.AddMust(bleve.NewMatchAllQuery())
+	}
+	return bq
+}
+
+func (mbs *MTBleveSearch) StatsByACL(catalog []string) (int64, FacetCountResult, error) {
+	return mbs.StatsByACLContext(context.Background(), catalog)
+}
+
+func (mbs *MTBleveSearch) StatsByACLContext(ctx context.Context, catalog []string) (int64, FacetCountResult, error) {
+	filters := []query.Query{}
+	if len(catalog) > 0 {
+		filters = append(filters, bleveTermsQuery("catalog", catalog...))
+	}
+	req := bleve.NewSearchRequestOptions(bleveQuery(nil, filters), 0, 0, false)
+	req.AddFacet("acl.meta", bleve.NewFacetRequest("acl.meta", bleveDefaultFacetSize))
+	req.AddFacet("acl.content", bleve.NewFacetRequest("acl.content", bleveDefaultFacetSize))
+	req.AddFacet("mediatype", bleve.NewFacetRequest("mediatype", bleveDefaultFacetSize))
+	res, err := mbs.index.SearchInContext(ctx, req)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "cannot query statistics")
+	}
+	return int64(res.Total), bleveFacetCountResult(res), nil
+}
+
+func bleveFacetCountResult(res *bleve.SearchResult) FacetCountResult {
+	var fcr FacetCountResult = make(FacetCountResult)
+	for name, facet := range res.Facets {
+		fcr[name] = map[string]int{}
+		for _, dr := range facet.DateRanges {
+			if dr.Count > 0 {
+				fcr[name][dr.Name] = dr.Count
+			}
+		}
+		if facet.Terms == nil {
+			continue
+		}
+		for _, term := range facet.Terms.Terms() {
+			fcr[name][term.Term] = term.Count
+		}
+	}
+	return fcr
+}
+
+func (mbs *MTBleveSearch) Scroll(ctx context.Context, cfg *ScrollConfig, callback func(data *SourceData) error) error {
+	filters := bleveFilters(cfg.Groups, cfg.IsAdmin, cfg.ContentVisible, cfg.FiltersFields, true)
+	q := bleveQuery(bleveMatchQuery(strings.TrimSpace(cfg.QStr), "", mbs.ranking.Load()), filters)
+
+	// the id of a document is the signature
+	var after []string
+	if cfg.After != "" {
+		after = []string{cfg.After}
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return errors.Wrap(err, "scroll cancelled")
+		}
+		req := bleve.NewSearchRequestOptions(q, bleveScrollSize, 0, false)
+		req.Fields = []string{"data"}
+		req.SortBy([]string{"_id"})
+		if after != nil {
+			req.SetSearchAfter(after)
+		}
+		res, err := mbs.index.SearchInContext(ctx, req)
+		if err != nil {
+			return errors.Wrap(err, "cannot scroll")
+		}
+		for _, hit := range res.Hits {
+			sd, err := bleveHitSource(hit.Fields)
+			if err != nil {
+				return errors.Wrapf(err, "cannot decode document %s", hit.ID)
+			}
+			if err := callback(sd); err != nil {
+				return errors.Wrapf(err, "error in callback for id %v", hit.ID)
+			}
+		}
+		if len(res.Hits) < bleveScrollSize {
+			break
+		}
+		after = res.Hits[len(res.Hits)-1].Sort
+	}
+	return nil
+}
+
+// bleveSortOrder creates the sort of the search, the signature makes the order stable between the pages
+func bleveSortOrder(so SortOrder, lang string) []string {
+	prefix := ""
+	if so.order() == SortDesc {
+		prefix = "-"
+	}
+	field := so.indexField(lang)
+	switch field {
+	case "":
+		return []string{prefix + "_score", prefix + "signature"}
+	case "signature":
+		return []string{prefix + "signature"}
+	}
+	return []string{prefix + field, prefix + "signature"}
+}
+
+func (mbs *MTBleveSearch) Search(cfg *SearchConfig) ([]map[string][]string, []*SourceData, int64, FacetCountResult, string, error) {
+	return mbs.SearchContext(context.Background(), cfg)
+}
+
+func (mbs *MTBleveSearch) SearchContext(ctx context.Context, cfg *SearchConfig) ([]map[string][]string, []*SourceData, int64, FacetCountResult, string, error) {
+	// vector search needs the faiss build of bleve
+	if (cfg.Mode == SearchModeSemantic || cfg.Mode == SearchModeHybrid) && strings.TrimSpace(cfg.QStr) != "" {
+		return nil, nil, 0, nil, "", errors.Errorf("search mode %s not supported by bleve", cfg.Mode)
+	}
+	// bleve cannot continue after a _score, the cursor of bleve is the offset
+	start, _, err := searchPage(cfg)
+	if err != nil {
+		return nil, nil, 0, nil, "", err
+	}
+	filters := bleveFilters(cfg.Groups, cfg.IsAdmin, cfg.ContentVisible, cfg.FiltersFields, false)
+	for _, rf := range cfg.RangeFilters {
+		filters = append(filters, bleveDateRangeQuery(rf.Field, rf.From, rf.To))
+	}
+	ranking := mbs.ranking.Load()
+	match := bleveMatchQuery(strings.TrimSpace(cfg.QStr), cfg.Lang, ranking)
+	bq := bleveQuery(match, filters).(*query.BooleanQuery)
+	bleveRanking(bq, ranking)
+
+	// selected facet values work like the elastic post_filter: they restrict the hits but not the facet counts
+	postfilters := []query.Query{}
+	for field, vals := range cfg.Facets {
+		values := []string{}
+		for val, selected := range vals.Selected {
+			if selected {
+				values = append(values, val)
+			}
+		}
+		if len(values) > 0 {
+			postfilters = append(postfilters, bleveTermsQuery(bleveKeywordFieldName(field), values...))
+		}
+	}
+	var q query.Query = bq
+	if len(postfilters) > 0 {
+		q = bleve.NewConjunctionQuery(append([]query.Query{bq}, postfilters...)...)
+	}
+
+	req := bleve.NewSearchRequestOptions(q, cfg.Rows, start, false)
+	req.Fields = []string{"data"}
+	req.SortBy(bleveSortOrder(cfg.Sort, cfg.Lang))
+	req.Explain = cfg.Debug != nil
+	if match != nil {
+		req.Highlight = bleve.NewHighlightWithStyle(bleveHighlighter)
+		req.Highlight.AddField("abstract")
+		req.Highlight.AddField("notes")
+		req.Highlight.AddField("media.pdf.fulltext")
+	}
+
+	facetReq := req
+	if len(postfilters) > 0 && (len(cfg.Facets) > 0 || len(cfg.RangeFacets) > 0) {
+		facetReq = bleve.NewSearchRequestOptions(bq, 0, 0, false)
+	}
+	for field, vals := range cfg.Facets {
+		size := int(vals.Limit)
+		if size <= 0 {
+			size = bleveDefaultFacetSize
+			if vals.Type == FacetTypeHierarchy {
+				size = hierarchyFacetSize
+			}
+		}
+		facetReq.AddFacet(field, bleve.NewFacetRequest(bleveKeywordFieldName(field), size))
+	}
+	// bleve has no histogram facet, only the ranges are counted
+	for name, rf := range cfg.RangeFacets {
+		if rf.Type != FacetTypeRange {
+			continue
+		}
+		fr := bleve.NewFacetRequest(rf.Field, len(rf.Ranges))
+		for _, r := range rf.Ranges {
+			fr.AddDateTimeRange(r.Key, r.From, r.To)
+		}
+		facetReq.AddFacet(name, fr)
+	}
+
+	res, err := mbs.index.SearchInContext(ctx, req)
+	if err != nil {
+		return nil, nil, 0, nil, "", errors.Wrap(err, "cannot search")
+	}
+	facetRes := res
+	if facetReq != req {
+		facetRes, err = mbs.index.SearchInContext(ctx, facetReq)
+		if err != nil {
+			return nil, nil, 0, nil, "", errors.Wrap(err, "cannot get facets")
+		}
+	}
+
+	var debugQuery *SearchDebugQuery
+	if cfg.Debug != nil {
+		cfg.Debug.Engine = "bleve"
+		if debugQuery, err = cfg.Debug.addQuery("search", req, res.Took); err != nil {
+			return nil, nil, 0, nil, "", errors.Wrap(err, "cannot marshal query for debugging")
+		}
+	}
+
+	sdarr := []*SourceData{}
+	highlightarr := []map[string][]string{}
+	for _, hit := range res.Hits {
+		sd, err := bleveHitSource(hit.Fields)
+		if err != nil {
+			return nil, nil, 0, nil, "", errors.Wrapf(err, "cannot decode document %s", hit.ID)
+		}
+		if debugQuery != nil {
+			if err := debugQuery.addHit(hit.ID, hit.Score, hit.Expl); err != nil {
+				return nil, nil, 0, nil, "", errors.Wrapf(err, "cannot marshal explanation of %s", hit.ID)
+			}
+		}
+		var hl map[string][]string
+		if len(hit.Fragments) > 0 {
+			hl = map[string][]string(hit.Fragments)
+		}
+		highlightarr = append(highlightarr, hl)
+		sdarr = append(sdarr, sd)
+	}
+	next, err := nextSearchCursor(cfg, start, len(sdarr), int64(res.Total), nil)
+	if err != nil {
+		return nil, nil, 0, nil, "", err
+	}
+	return highlightarr, sdarr, int64(res.Total), bleveFacetCountResult(facetRes), next, nil
+}
+
+/*
+Related returns the documents which are similar to doc.
+bleve has no more_like_this, the words of title and abstract are matched like a search
+*/
+func (mbs *MTBleveSearch) Related(ctx context.Context, doc *SourceData, cfg *SearchConfig) ([]*SourceData, error) {
+	should := []query.Query{}
+	if text := relatedText(doc); text != "" {
+		for _, fld := range []string{"title", "abstract"} {
+			mq := bleve.NewMatchQuery(text)
+			mq.SetField(fld)
+			should = append(should, mq)
+		}
+	}
+	boosted := func(boost float64, field string, values ...string) {
+		dq := bleveTermsQuery(field, values...).(*query.DisjunctionQuery)
+		dq.SetBoost(boost)
+		should = append(should, dq)
+	}
+	if persons := relatedPersons(doc); len(persons) > 0 {
+		boosted(3, bleveKeywordFieldName("persons.name"), persons...)
+	}
+	if len(doc.Tags) > 0 {
+		boosted(1, "tags", doc.Tags...)
+	}
+	if categories := relatedCategories(doc.Category); len(categories) > 0 {
+		boosted(2, "category", categories...)
+	}
+	if len(should) == 0 {
+		return []*SourceData{}, nil
+	}
+	bq := bleve.NewBooleanQuery()
+	bq.AddShould(should...)
+	bq.AddMustNot(bleve.NewDocIDQuery([]string{doc.Signature}))
+	if filters := bleveFilters(cfg.Groups, cfg.IsAdmin, cfg.ContentVisible, cfg.FiltersFields, false); len(filters) > 0 {
+		bq.AddMust(filters...)
+	}
+	req := bleve.NewSearchRequestOptions(bq, cfg.Rows, 0, false)
+	req.Fields = []string{"data"}
+	res, err := mbs.index.SearchInContext(ctx, req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot search documents related to %s", doc.Signature)
+	}
+	sdarr := []*SourceData{}
+	for _, hit := range res.Hits {
+		sd, err := bleveHitSource(hit.Fields)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot decode document %s", hit.ID)
+		}
+		sdarr = append(sdarr, sd)
+	}
+	return sdarr, nil
+}
+
+// Suggest completes the text in cfg.QStr, every word is a prefix of title, person, tag or category
+func (mbs *MTBleveSearch) Suggest(ctx context.Context, cfg *SearchConfig) ([]Suggestion, error) {
+	text := strings.TrimSpace(cfg.QStr)
+	wordQueries := []query.Query{}
+	for _, word := range wordsRegexp.FindAllString(strings.ToLower(text), -1) {
+		fields := []query.Query{}
+		for _, fld := range []string{"title", "persons.name", "suggest"} {
+			pq := bleve.NewPrefixQuery(word)
+			pq.SetField(fld)
+			fields = append(fields, pq)
+		}
+		wordQueries = append(wordQueries, bleve.NewDisjunctionQuery(fields...))
+	}
+	if len(wordQueries) == 0 {
+		return []Suggestion{}, nil
+	}
+	q := bleveQuery(bleve.NewConjunctionQuery(wordQueries...), bleveFilters(cfg.Groups, cfg.IsAdmin, cfg.ContentVisible, cfg.FiltersFields, false))
+	req := bleve.NewSearchRequestOptions(q, suggestDocs, 0, false)
+	req.Fields = []string{"data"}
+	res, err := mbs.index.SearchInContext(ctx, req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot search suggestions for '%s'", text)
+	}
+	docs := []*SourceData{}
+	for _, hit := range res.Hits {
+		sd, err := bleveHitSource(hit.Fields)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot decode document %s", hit.ID)
+		}
+		docs = append(docs, sd)
+	}
+	return collectSuggestions(docs, text, cfg.Rows), nil
+}
+
+/*
+DidYouMean corrects the words of cfg.QStr with the terms of titles, persons and tags.
+bleve has no term suggester, the terms within spellMaxEdits are read from the fuzzy term dictionary
+*/
+func (mbs *MTBleveSearch) DidYouMean(ctx context.Context, cfg *SearchConfig) ([]SpellSuggestion, error) {
+	words := map[string]bool{}
+	for _, word := range wordsRegexp.FindAllString(strings.ToLower(queryText(cfg.QStr)), -1) {
+		if len([]rune(word)) >= 3 {
+			words[word] = true
+		}
+	}
+	if len(words) == 0 {
+		return []SpellSuggestion{}, nil
+	}
+	idx, err := mbs.index.Advanced()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get bleve index")
+	}
+	reader, err := idx.Reader()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot open bleve index reader")
+	}
+	defer reader.Close()
+	fuzzy, ok := reader.(index.IndexReaderFuzzy)
+	if !ok {
+		return nil, errors.New("bleve index has no fuzzy term dictionary")
+	}
+	options := map[string][]spellOption{}
+	for _, fld := range []string{"title", "persons.name", "suggest"} {
+		for word := range words {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			dict, err := fuzzy.FieldDictFuzzy(fld, word, spellMaxEdits, "")
+			if err != nil {
+				return nil, errors.Wrapf(err, "cannot read terms of %s", fld)
+			}
+			for {
+				entry, err := dict.Next()
+				if err != nil {
+					dict.Close()
+					return nil, errors.Wrapf(err, "cannot read terms of %s", fld)
+				}
+				if entry == nil {
+					break
+				}
+				if words[entry.Term] {
+					continue
+				}
+				if dist := levenshtein(word, entry.Term); dist <= spellMaxEdits {
+					options[word] = append(options[word], spellOption{Text: entry.Term, Score: 1 / float64(1+dist), Freq: int64(entry.Count)})
+				}
+			}
+			dict.Close()
+		}
+	}
+	return spellSuggestions(cfg.QStr, options, spellCount(ctx, cfg, mbs.SearchContext))
+}
+
+func (mbs *MTBleveSearch) LastUpdate(cfg *ScrollConfig) (time.Time, error) {
+	return mbs.LastUpdateContext(context.Background(), cfg)
+}
+
+func (mbs *MTBleveSearch) LastUpdateContext(ctx context.Context, cfg *ScrollConfig) (time.Time, error) {
+	var lastUpdate time.Time
+	filters := bleveFilters(cfg.Groups, cfg.IsAdmin, cfg.ContentVisible, cfg.FiltersFields, false)
+	req := bleve.NewSearchRequestOptions(bleveQuery(bleveMatchQuery(strings.TrimSpace(cfg.QStr), "", mbs.ranking.Load()), filters), 1, 0, false)
+	req.Fields = []string{"data"}
+	req.SortBy([]string{"-timestamp"})
+	res, err := mbs.index.SearchInContext(ctx, req)
+	if err != nil {
+		return lastUpdate, errors.Wrap(err, "cannot query last update")
+	}
+	if len(res.Hits) != 1 {
+		return lastUpdate, nil
+	}
+	sd, err := bleveHitSource(res.Hits[0].Fields)
+	if err != nil {
+		return lastUpdate, errors.Wrapf(err, "cannot decode document %s", res.Hits[0].ID)
+	}
+	return sd.Timestamp, nil
+}
+
+func (mbs *MTBleveSearch) Delete(cfg *ScrollConfig) (int64, error) {
+	return mbs.DeleteContext(context.Background(), cfg)
+}
+
+func (mbs *MTBleveSearch) DeleteContext(ctx context.Context, cfg *ScrollConfig) (int64, error) {
+	filters := bleveFilters(cfg.Groups, cfg.IsAdmin, cfg.ContentVisible, cfg.FiltersFields, false)
+	q := bleveQuery(bleveMatchQuery(strings.TrimSpace(cfg.QStr), "", mbs.ranking.Load()), filters)
+
+	// collect first, deleting while paging would shift the result window
+	ids := []string{}
+	for {
+		req := bleve.NewSearchRequestOptions(q, bleveScrollSize, len(ids), false)
+		req.SortBy([]string{"_id"})
+		res, err := mbs.index.SearchInContext(ctx, req)
+		if err != nil {
+			return 0, errors.Wrap(err, "cannot query documents to delete")
+		}
+		for _, hit := range res.Hits {
+			ids = append(ids, hit.ID)
+		}
+		if len(res.Hits) < bleveScrollSize {
+			break
+		}
+	}
+	batch := mbs.index.NewBatch()
+	for _, id := range ids {
+		batch.Delete(id)
+	}
+	if err := mbs.index.Batch(batch); err != nil {
+		return 0, errors.Wrapf(err, "cannot delete %v documents", len(ids))
+	}
+	return int64(len(ids)), nil
+}
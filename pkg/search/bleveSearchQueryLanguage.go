@@ -0,0 +1,195 @@
+package search
+
+import (
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+	"strings"
+	"time"
+)
+
+// fields which are searched with the analyzer instead of exact terms
+var bleveTextFields = map[string]bool{
+	"title":              true,
+	"abstract":           true,
+	"notes":              true,
+	"persons.name":       true,
+	"media.pdf.fulltext": true,
+}
+
+/*
+bleveTermQuery searches a word or a phrase in an analyzed field.
+words are prefixes like appendStar of elastic, several words of a term must all match.
+nil if the term has no words
+*/
+func bleveTermQuery(field string, term *QueryTermNode, boost float64) query.Query {
+	switch {
+	case term.Phrase:
+		mpq := bleve.NewMatchPhraseQuery(term.Value)
+		mpq.SetField(field)
+		mpq.SetBoost(boost)
+		return mpq
+	case term.Wildcard:
+		wq := bleve.NewWildcardQuery(strings.ToLower(term.Value))
+		wq.SetField(field)
+		wq.SetBoost(boost)
+		return wq
+	}
+	prefixes := []query.Query{}
+	for _, word := range wordsRegexp.FindAllString(strings.ToLower(term.Value), -1) {
+		pq := bleve.NewPrefixQuery(word)
+		pq.SetField(field)
+		pq.SetBoost(boost)
+		prefixes = append(prefixes, pq)
+	}
+	switch len(prefixes) {
+	case 0:
+		return nil
+	case 1:
+		return prefixes[0]
+	}
+	return bleve.NewConjunctionQuery(prefixes...)
+}
+
+/*
+bleveFulltextQuery searches the terms in all fields of the default search boosted by r.
+with lang the text is matched with the stemmer of the language on the language fields
+*/
+func bleveFulltextQuery(terms []*QueryTermNode, lang string, r *Ranking) query.Query {
+	queries := []query.Query{}
+	texts := []string{}
+	for _, term := range terms {
+		for fld := range defaultFieldBoosts {
+			if tq := bleveTermQuery(fld, term, r.boost(fld)); tq != nil {
+				queries = append(queries, tq)
+			}
+		}
+		texts = append(texts, term.Value)
+	}
+	if len(queries) == 0 {
+		return nil
+	}
+	for _, fld := range []string{"title", "abstract"} {
+		for _, lf := range langFieldBoosts(fld, r.boost(fld), lang) {
+			mq := bleve.NewMatchQuery(strings.Join(texts, " "))
+			mq.SetField(lf.Field)
+			mq.SetBoost(lf.Boost)
+			queries = append(queries, mq)
+		}
+	}
+	return bleve.NewDisjunctionQuery(queries...)
+}
+
+func bleveFieldQuery(term *QueryTermNode) query.Query {
+	switch {
+	case bleveTextFields[term.Field]:
+		if tq := bleveTermQuery(term.Field, term, 1); tq != nil {
+			return tq
+		}
+		return bleve.NewMatchNoneQuery()
+	case term.Wildcard:
+		wq := bleve.NewWildcardQuery(term.Value)
+		wq.SetField(bleveKeywordFieldName(term.Field))
+		return wq
+	default:
+		return bleveFilterQuery(term.Field, term.Value)
+	}
+}
+
+/*
+bleveRangeFieldQuery creates a range query.
+the date compares the item date with the periods of elasticRangeFieldQuery,
+bounds which are no dates (e.g. "now-10y") are not supported by bleve and match nothing
+*/
+func bleveRangeFieldQuery(rng *QueryRangeNode) query.Query {
+	if rng.Field != "date" {
+		min, max := strings.TrimSuffix(rng.From, "*"), strings.TrimSuffix(rng.To, "*")
+		trq := bleve.NewTermRangeInclusiveQuery(min, max, &rng.IncludeLower, &rng.IncludeUpper)
+		trq.SetField(bleveKeywordFieldName(rng.Field))
+		return trq
+	}
+	var from, to time.Time
+	if rng.From != "*" {
+		begin, end, ok := itemDatePeriod(rng.From)
+		if !ok {
+			return bleve.NewMatchNoneQuery()
+		}
+		from = end
+		if rng.IncludeLower {
+			from = begin
+		}
+	}
+	if rng.To != "*" {
+		begin, end, ok := itemDatePeriod(rng.To)
+		if !ok {
+			return bleve.NewMatchNoneQuery()
+		}
+		to = begin
+		if rng.IncludeUpper {
+			to = end
+		}
+	}
+	if from.IsZero() && to.IsZero() {
+		return bleve.NewMatchAllQuery()
+	}
+	return bleveDateRangeQuery("itemdate", from, to)
+}
+
+/*
+bleveQueryFromNode compiles the parsed search box query like elasticQueryFromNode.
+terms without field of a sequence or an OR are collected into one fulltext query, lang is the query language.
+nil if nothing is searched
+*/
+func bleveQueryFromNode(node QueryNode, lang string, r *Ranking) query.Query {
+	switch n := node.(type) {
+	case *QueryTermNode:
+		if n.Field == "" {
+			return bleveFulltextQuery([]*QueryTermNode{n}, lang, r)
+		}
+		return bleveFieldQuery(n)
+	case *QueryRangeNode:
+		return bleveRangeFieldQuery(n)
+	case *QueryNotNode:
+		bq := bleve.NewBooleanQuery()
+		bq.AddMust(bleve.NewMatchAllQuery())
+		if child := bleveQueryFromNode(n.Child, lang, r); child != nil {
+			bq.AddMustNot(child)
+		}
+		return bq
+	case *QueryBoolNode:
+		positives := []query.Query{}
+		negatives := []query.Query{}
+		texts := []*QueryTermNode{}
+		for _, child := range n.Children {
+			if not, ok := child.(*QueryNotNode); ok {
+				if q := bleveQueryFromNode(not.Child, lang, r); q != nil {
+					negatives = append(negatives, q)
+				}
+				continue
+			}
+			if term, ok := child.(*QueryTermNode); ok && term.Field == "" && n.Op != QueryOperatorAND {
+				texts = append(texts, term)
+				continue
+			}
+			if q := bleveQueryFromNode(child, lang, r); q != nil {
+				positives = append(positives, q)
+			}
+		}
+		if q := bleveFulltextQuery(texts, lang, r); q != nil {
+			positives = append(positives, q)
+		}
+		bq := bleve.NewBooleanQuery()
+		switch {
+		case len(positives) == 0:
+			bq.AddMust(bleve.NewMatchAllQuery())
+		case n.Op == QueryOperatorAND:
+			bq.AddMust(positives...)
+		default:
+			bq.AddMust(bleve.NewDisjunctionQuery(positives...))
+		}
+		if len(negatives) > 0 {
+			bq.AddMustNot(negatives...)
+		}
+		return bq
+	}
+	return nil
+}
@@ -0,0 +1,476 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/je4/zsearch/v2/pkg/translate"
+	"github.com/rs/zerolog"
+	"golang.org/x/text/language"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestBleveSearch(t *testing.T) *MTBleveSearch {
+	logger := zerolog.Nop()
+	mbs, err := NewMTBleveSearch(filepath.Join(t.TempDir(), "bleve"), &logger)
+	if err != nil {
+		t.Fatalf("cannot create bleve index: %v", err)
+	}
+	t.Cleanup(func() { mbs.Close() })
+
+	for i, doc := range []struct {
+		signature string
+		title     string
+		abstract  string
+		meta      []string
+		category  []string
+		hasMedia  bool
+		date      string
+	}{
+		{"test-1", "Kunst im Raum", "ein Text über Kunst und Design", []string{"global/guest"}, []string{"2!!kunst!!design"}, true, "ca. 1995"},
+		{"test-2", "Raum und Zeit", "ein Text über Architektur", []string{"global/guest"}, []string{"2!!kunst!!architektur"}, false, "2003-05-01"},
+		{"test-3", "Interner Bericht", "nur für Angehörige", []string{"global/admin"}, []string{"1!!intern"}, false, ""},
+	} {
+		title := &translate.MultiLangString{}
+		title.Set(doc.title, language.German, false)
+		abstract := &translate.MultiLangString{}
+		abstract.Set(doc.abstract, language.German, false)
+		sd := &SourceData{
+			Signature: doc.signature,
+			Source:    "test",
+			Title:     title,
+			Abstract:  abstract,
+			ACL:       map[string][]string{"meta": doc.meta, "content": doc.meta},
+			Catalog:   []string{"test"},
+			Category:  doc.category,
+			HasMedia:  doc.hasMedia,
+			Date:      doc.date,
+			DateAdded: time.Date(2020, 1, i+1, 0, 0, 0, 0, time.UTC),
+		}
+		if err := mbs.UpdateTimestamp(sd, time.Date(2020, 1, i+1, 0, 0, 0, 0, time.UTC)); err != nil {
+			t.Fatalf("cannot index %s: %v", doc.signature, err)
+		}
+	}
+	return mbs
+}
+
+func TestBleveSearch(t *testing.T) {
+	mbs := newTestBleveSearch(t)
+
+	highlights, docs, total, fcr, _, err := mbs.Search(&SearchConfig{
+		QStr:   "kunst",
+		Groups: []string{"global/guest"},
+		Facets: map[string]TermFacet{"category": {}},
+		Rows:   10,
+	})
+	if err != nil {
+		t.Fatalf("cannot search: %v", err)
+	}
+	if total != 1 || len(docs) != 1 || docs[0].Signature != "test-1" {
+		t.Errorf("unexpected search result: %v hits", total)
+	}
+	if len(highlights) != 1 || len(highlights[0]["abstract"]) == 0 {
+		t.Errorf("missing highlight for abstract: %v", highlights)
+	}
+	if fcr["category"]["2!!kunst!!design"] != 1 {
+		t.Errorf("unexpected category facet: %v", fcr["category"])
+	}
+
+	_, _, total, _, _, err = mbs.Search(&SearchConfig{
+		Groups:        []string{"global/guest"},
+		FiltersFields: map[string][]string{"category": {"2!!kunst"}},
+		Rows:          10,
+	})
+	if err != nil {
+		t.Fatalf("cannot search: %v", err)
+	}
+	if total != 2 {
+		t.Errorf("category filter returned %v hits, expected 2", total)
+	}
+
+	_, _, total, _, _, err = mbs.Search(&SearchConfig{
+		Groups: []string{"global/guest"},
+		Facets: map[string]TermFacet{"category": {Selected: map[string]bool{"2!!kunst!!architektur": true}}},
+		Rows:   10,
+	})
+	if err != nil {
+		t.Fatalf("cannot search: %v", err)
+	}
+	if total != 1 {
+		t.Errorf("selected facet returned %v hits, expected 1", total)
+	}
+}
+
+func TestBleveQueryLanguage(t *testing.T) {
+	mbs := newTestBleveSearch(t)
+	for qstr, expected := range map[string]string{
+		`raum`:                      "test-1 test-2",
+		`raum AND kunst`:            "test-1",
+		`raum NOT kunst`:            "test-2",
+		`"raum und zeit"`:           "test-2",
+		`"zeit und raum"`:           "",
+		`title:zeit`:                "test-2",
+		`abstract:raum`:             "",
+		`k?nst`:                     "test-1",
+		`date:[1990 TO 1999]`:       "test-1",
+		`date:{1995 TO *]`:          "test-2",
+		`date:[2003-05 TO 2003-05]`: "test-2",
+		`raum -date:[2000 TO *]`:    "test-1",
+		`date:[now-10y TO now]`:     "",
+	} {
+		_, docs, _, _, _, err := mbs.Search(&SearchConfig{
+			QStr:   qstr,
+			Groups: []string{"global/guest"},
+			Rows:   10,
+		})
+		if err != nil {
+			t.Fatalf("%s: cannot search: %v", qstr, err)
+		}
+		signatures := []string{}
+		for _, doc := range docs {
+			signatures = append(signatures, doc.Signature)
+		}
+		sort.Strings(signatures)
+		if result := strings.Join(signatures, " "); result != expected {
+			t.Errorf("%s: found [%s] instead of [%s]", qstr, result, expected)
+		}
+	}
+}
+
+func TestBleveScrollDelete(t *testing.T) {
+	mbs := newTestBleveSearch(t)
+
+	var count int
+	if err := mbs.Scroll(context.Background(), &ScrollConfig{IsAdmin: true}, func(data *SourceData) error {
+		count++
+		return nil
+	}); err != nil {
+		t.Fatalf("cannot scroll: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("scroll returned %v documents, expected 3", count)
+	}
+
+	// resume after the checkpoint
+	signatures := []string{}
+	if err := mbs.Scroll(context.Background(), &ScrollConfig{IsAdmin: true, After: "test-1"}, func(data *SourceData) error {
+		signatures = append(signatures, data.Signature)
+		return nil
+	}); err != nil {
+		t.Fatalf("cannot scroll: %v", err)
+	}
+	if len(signatures) != 2 || signatures[0] != "test-2" {
+		t.Errorf("scroll after test-1 returned %v", signatures)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := mbs.Scroll(ctx, &ScrollConfig{IsAdmin: true}, func(data *SourceData) error {
+		return nil
+	}); err == nil {
+		t.Errorf("scroll with cancelled context succeeded")
+	}
+
+	lastUpdate, err := mbs.LastUpdate(&ScrollConfig{IsAdmin: true})
+	if err != nil {
+		t.Fatalf("cannot get last update: %v", err)
+	}
+	if lastUpdate.Day() != 3 {
+		t.Errorf("unexpected last update %v", lastUpdate)
+	}
+
+	num, err := mbs.Delete(&ScrollConfig{IsAdmin: true, FiltersFields: map[string][]string{"signature": {"test-*"}}})
+	if err != nil {
+		t.Fatalf("cannot delete: %v", err)
+	}
+	if num != 3 {
+		t.Errorf("deleted %v documents, expected 3", num)
+	}
+	docs, err := mbs.LoadDocs([]string{"test-1"}, context.Background())
+	if err != nil {
+		t.Fatalf("cannot load documents: %v", err)
+	}
+	if len(docs) != 0 {
+		t.Errorf("document test-1 not deleted")
+	}
+}
+
+func TestBleveRangeFacets(t *testing.T) {
+	mbs := newTestBleveSearch(t)
+
+	now := time.Date(2020, 1, 10, 12, 0, 0, 0, time.UTC)
+	facets := DateFacets(now)
+	_, _, total, fcr, _, err := mbs.Search(&SearchConfig{
+		Groups:      []string{"global/guest"},
+		RangeFacets: facets,
+		Rows:        10,
+	})
+	if err != nil {
+		t.Fatalf("cannot search: %v", err)
+	}
+	if total != 2 || fcr[DateFacetDecade]["1990"] != 1 || fcr[DateFacetDecade]["2000"] != 1 || fcr[DateFacetAdded]["30d"] != 2 || fcr[DateFacetAdded]["7d"] != 0 {
+		t.Errorf("unexpected range facets: %v", fcr)
+	}
+
+	filters, err := RangeFilters(facets, map[string]string{DateFacetDecade: "2000"})
+	if err != nil {
+		t.Fatalf("cannot create range filters: %v", err)
+	}
+	_, docs, total, _, _, err := mbs.Search(&SearchConfig{
+		Groups:       []string{"global/guest"},
+		RangeFilters: filters,
+		Rows:         10,
+	})
+	if err != nil {
+		t.Fatalf("cannot search: %v", err)
+	}
+	if total != 1 || docs[0].Signature != "test-2" {
+		t.Errorf("unexpected result of decade filter: %v hits", total)
+	}
+	if _, err := RangeFilters(facets, map[string]string{DateFacetDecade: "1234"}); err == nil {
+		t.Errorf("unknown range should fail")
+	}
+}
+
+func TestBleveSearchCursor(t *testing.T) {
+	mbs := newTestBleveSearch(t)
+
+	cfg := &SearchConfig{
+		Groups:  []string{"global/admin"},
+		IsAdmin: true,
+		Rows:    2,
+	}
+	_, docs, total, _, next, err := mbs.Search(cfg)
+	if err != nil {
+		t.Fatalf("cannot search: %v", err)
+	}
+	if total != 3 || len(docs) != 2 || next == "" {
+		t.Fatalf("unexpected first page: %v hits, %v docs, next '%s'", total, len(docs), next)
+	}
+	seen := map[string]bool{docs[0].Signature: true, docs[1].Signature: true}
+
+	cfg.Cursor = next
+	_, docs, _, _, next, err = mbs.Search(cfg)
+	if err != nil {
+		t.Fatalf("cannot search with cursor: %v", err)
+	}
+	if len(docs) != 1 || seen[docs[0].Signature] || next != "" {
+		t.Errorf("unexpected last page: %v docs, next '%s'", len(docs), next)
+	}
+
+	// a cursor must not be used with another query
+	other := *cfg
+	other.QStr = "kunst"
+	if _, _, _, _, _, err := mbs.Search(&other); err == nil {
+		t.Errorf("cursor of another query should fail")
+	}
+}
+
+func TestBleveSort(t *testing.T) {
+	mbs := newTestBleveSearch(t)
+
+	for str, expected := range map[string][]string{
+		"dateadded":      {"test-3", "test-2", "test-1"},
+		"dateadded:asc":  {"test-1", "test-2", "test-3"},
+		"title":          {"test-3", "test-1", "test-2"},
+		"title:desc":     {"test-2", "test-1", "test-3"},
+		"signature:desc": {"test-3", "test-2", "test-1"},
+	} {
+		so, err := ParseSortOrder(str)
+		if err != nil {
+			t.Fatalf("cannot parse sort order %s: %v", str, err)
+		}
+		_, docs, _, _, _, err := mbs.Search(&SearchConfig{
+			IsAdmin: true,
+			Rows:    10,
+			Sort:    so,
+			Lang:    "en",
+		})
+		if err != nil {
+			t.Fatalf("cannot search: %v", err)
+		}
+		signatures := []string{}
+		for _, doc := range docs {
+			signatures = append(signatures, doc.Signature)
+		}
+		if strings.Join(signatures, ",") != strings.Join(expected, ",") {
+			t.Errorf("sort %s returned %v, expected %v", str, signatures, expected)
+		}
+	}
+
+	if _, err := ParseSortOrder("title:up"); err == nil {
+		t.Errorf("invalid sort order accepted")
+	}
+}
+
+func TestBleveRelated(t *testing.T) {
+	mbs := newTestBleveSearch(t)
+
+	docs, err := mbs.LoadDocs([]string{"test-1"}, context.Background())
+	if err != nil {
+		t.Fatalf("cannot load documents: %v", err)
+	}
+	related, err := mbs.Related(context.Background(), docs["test-1"], &SearchConfig{
+		Groups: []string{"global/guest"},
+		Rows:   10,
+	})
+	if err != nil {
+		t.Fatalf("cannot get related documents: %v", err)
+	}
+	// test-3 is not visible for guests
+	if len(related) != 1 || related[0].Signature != "test-2" {
+		t.Errorf("unexpected related documents: %v", related)
+	}
+}
+
+func TestBleveSuggest(t *testing.T) {
+	mbs := newTestBleveSearch(t)
+
+	for text, expected := range map[string]string{
+		"kun":    "title:Kunst im Raum",
+		"archit": "category:2!!kunst!!architektur",
+		"inter":  "",
+	} {
+		suggestions, err := mbs.Suggest(context.Background(), &SearchConfig{
+			QStr:   text,
+			Groups: []string{"global/guest"},
+			Rows:   10,
+		})
+		if err != nil {
+			t.Fatalf("cannot get suggestions: %v", err)
+		}
+		found := []string{}
+		for _, s := range suggestions {
+			found = append(found, string(s.Type)+":"+s.Value)
+		}
+		// "Interner Bericht" is not visible for guests
+		if strings.Join(found, ",") != expected {
+			t.Errorf("suggestions for '%s': %v, expected %s", text, found, expected)
+		}
+	}
+}
+
+func TestBleveDidYouMean(t *testing.T) {
+	mbs := newTestBleveSearch(t)
+
+	for qstr, expected := range map[string]string{
+		"Kunts im Raum": "kunst im Raum",
+		"Intrener":      "",
+	} {
+		suggestions, err := mbs.DidYouMean(context.Background(), &SearchConfig{
+			QStr:   qstr,
+			Groups: []string{"global/guest"},
+			Rows:   10,
+		})
+		if err != nil {
+			t.Fatalf("cannot get spelling suggestions: %v", err)
+		}
+		found := []string{}
+		for _, s := range suggestions {
+			found = append(found, s.Query)
+		}
+		// "Interner Bericht" is not visible for guests
+		if len(found) > 0 && found[0] != expected || len(found) == 0 && expected != "" {
+			t.Errorf("spelling suggestions for '%s': %v, expected %s", qstr, found, expected)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := mbs.DidYouMean(ctx, &SearchConfig{QStr: "Kunts", Groups: []string{"global/guest"}, Rows: 10}); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled spelling suggestions: %v", err)
+	}
+}
+
+func TestBleveSearchLanguage(t *testing.T) {
+	mbs := newTestBleveSearch(t)
+
+	// the german stemmer finds "Kunst" for "Künste"
+	_, docs, _, _, _, err := mbs.Search(&SearchConfig{QStr: "Künste", Groups: []string{"global/guest"}, Rows: 10, Lang: "de"})
+	if err != nil {
+		t.Fatalf("cannot search: %v", err)
+	}
+	if len(docs) != 1 || docs[0].Signature != "test-1" {
+		t.Errorf("unexpected result for 'Künste': %v", docs)
+	}
+
+	for _, doc := range []struct {
+		signature  string
+		lang       language.Tag
+		translated bool
+	}{
+		{"test-en", language.English, false},
+		{"test-en-translated", language.English, true},
+	} {
+		title := &translate.MultiLangString{}
+		title.Set("Rooms of Art", doc.lang, doc.translated)
+		sd := &SourceData{
+			Signature: doc.signature,
+			Source:    "test",
+			Title:     title,
+			ACL:       map[string][]string{"meta": {"global/guest"}},
+			Catalog:   []string{"test"},
+		}
+		if err := mbs.Update(sd); err != nil {
+			t.Fatalf("cannot index %s: %v", doc.signature, err)
+		}
+	}
+	_, docs, _, _, _, err = mbs.Search(&SearchConfig{QStr: "room", Groups: []string{"global/guest"}, Rows: 10, Lang: "en"})
+	if err != nil {
+		t.Fatalf("cannot search: %v", err)
+	}
+	if len(docs) != 2 || docs[0].Signature != "test-en" {
+		t.Errorf("native title not ranked first: %v", docs)
+	}
+}
+
+func TestBleveSearchDebug(t *testing.T) {
+	mbs := newTestBleveSearch(t)
+
+	cfg := &SearchConfig{QStr: "kunst", Groups: []string{"global/guest"}, Rows: 10, Debug: &SearchDebug{}}
+	_, docs, _, _, _, err := mbs.Search(cfg)
+	if err != nil {
+		t.Fatalf("cannot search: %v", err)
+	}
+	if len(cfg.Debug.Queries) != 1 || len(cfg.Debug.Queries[0].Hits) != len(docs) {
+		t.Fatalf("unexpected debug output: %v", cfg.Debug)
+	}
+	hit := cfg.Debug.Queries[0].Hits[0]
+	if hit.Signature != "test-1" || hit.Score <= 0 || len(hit.Explanation) == 0 {
+		t.Errorf("missing score or explanation: %v", hit)
+	}
+	if !strings.Contains(cfg.Debug.Queries[0].QueryString(), "kunst") {
+		t.Errorf("query missing in %s", cfg.Debug.Queries[0].QueryString())
+	}
+}
+
+func TestBleveOutdatedMapping(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bleve")
+	old := bleveIndexMapping()
+	old.DefaultMapping.Properties["itemdate"] = bleve.NewDocumentStaticMapping()
+	index, err := bleve.New(path, old)
+	if err != nil {
+		t.Fatalf("cannot create bleve index: %v", err)
+	}
+	index.Close()
+	logger := zerolog.Nop()
+	if _, err := NewMTBleveSearch(path, &logger); !errors.Is(err, ErrOutdatedMapping) {
+		t.Errorf("outdated mapping not detected: %v", err)
+	}
+
+	path = filepath.Join(t.TempDir(), "bleve")
+	mbs, err := NewMTBleveSearch(path, &logger)
+	if err != nil {
+		t.Fatalf("cannot create bleve index: %v", err)
+	}
+	mbs.Close()
+	mbs, err = NewMTBleveSearch(path, &logger)
+	if err != nil {
+		t.Fatalf("cannot reopen bleve index: %v", err)
+	}
+	mbs.Close()
+}
@@ -0,0 +1,95 @@
+package search
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+/*
+searchCursor is the position after the last hit of a result page.
+After contains the sort values of the last hit for search_after, Offset the number of hits up to the cursor.
+the hash binds the cursor to the query it was created for
+*/
+type searchCursor struct {
+	After  []interface{} `json:"a,omitempty"`
+	Offset int           `json:"o"`
+	Hash   string        `json:"h"`
+}
+
+// cursorHash identifies the hits of a query independent of the page
+func cursorHash(cfg *SearchConfig) (string, error) {
+	c := *cfg
+	c.Start = 0
+	c.Rows = 0
+	c.Cursor = ""
+	// json sorts map keys, so the hash is stable
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot marshal search config")
+	}
+	return fmt.Sprintf("%x", md5.Sum(data))[:12], nil
+}
+
+// newSearchCursor creates the opaque cursor string
+func newSearchCursor(cfg *SearchConfig, offset int, after []interface{}) (string, error) {
+	hash, err := cursorHash(cfg)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(&searchCursor{After: after, Offset: offset, Hash: hash})
+	if err != nil {
+		return "", errors.Wrap(err, "cannot marshal cursor")
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// parseSearchCursor decodes cfg.Cursor. it is an error if the cursor belongs to another query
+func parseSearchCursor(cfg *SearchConfig) (*searchCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cfg.Cursor)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid cursor")
+	}
+	cursor := &searchCursor{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	// keep long values like dates exact
+	dec.UseNumber()
+	if err := dec.Decode(cursor); err != nil {
+		return nil, errors.Wrap(err, "invalid cursor")
+	}
+	hash, err := cursorHash(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cursor.Hash != hash {
+		return nil, errors.New("cursor does not belong to this query")
+	}
+	return cursor, nil
+}
+
+/*
+searchPage returns the offset and the search_after values of the requested page.
+without cursor the page starts at cfg.Start
+*/
+func searchPage(cfg *SearchConfig) (int, []interface{}, error) {
+	if cfg.Cursor == "" {
+		return cfg.Start, nil, nil
+	}
+	cursor, err := parseSearchCursor(cfg)
+	if err != nil {
+		return 0, nil, err
+	}
+	return cursor.Offset, cursor.After, nil
+}
+
+// nextSearchCursor returns the cursor of the next page or "" if the page is the last one
+func nextSearchCursor(cfg *SearchConfig, offset, hits int, total int64, after []interface{}) (string, error) {
+	if hits == 0 || int64(offset+hits) >= total {
+		return "", nil
+	}
+	return newSearchCursor(cfg, offset+hits, after)
+}
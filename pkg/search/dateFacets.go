@@ -0,0 +1,156 @@
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// names of the date facets of the search page
+const (
+	DateFacetAdded  = "added"
+	DateFacetDecade = "decade"
+	DateFacetYear   = "year"
+)
+
+// first decade of the decade facet, older items are counted in "before"
+const dateFacetFirstDecade = 1900
+
+var itemDateLayouts = []string{
+	"2006-01-02",
+	"2006-01",
+	"2006",
+	"02.01.2006",
+	"2.1.2006",
+	"01.2006",
+	"January 2, 2006",
+	"January 2006",
+	"2 January 2006",
+}
+
+var itemYearRegexp = regexp.MustCompile(`\b(1[0-9]{3}|20[0-9]{2})\b`)
+
+/*
+normalizeItemDate converts the free text date of an item to a time.
+if no layout matches, the first year in the text is used (e.g. "ca. 1980", "1980-1985")
+*/
+func normalizeItemDate(date string) *time.Time {
+	date = strings.TrimSpace(date)
+	if date == "" {
+		return nil
+	}
+	for _, layout := range itemDateLayouts {
+		if t, err := time.Parse(layout, date); err == nil {
+			return &t
+		}
+	}
+	if m := itemYearRegexp.FindStringSubmatch(date); m != nil {
+		year, _ := strconv.Atoi(m[1])
+		t := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+		return &t
+	}
+	return nil
+}
+
+// DecadeRanges creates the ranges from the decade of first to the decade of last, all before first are in "before"
+func DecadeRanges(first, last int) []FacetRange {
+	first -= first % 10
+	ranges := []FacetRange{{
+		Key: "before",
+		To:  time.Date(first, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}}
+	for decade := first; decade <= last; decade += 10 {
+		ranges = append(ranges, FacetRange{
+			Key:  strconv.Itoa(decade),
+			From: time.Date(decade, time.January, 1, 0, 0, 0, 0, time.UTC),
+			To:   time.Date(decade+10, time.January, 1, 0, 0, 0, 0, time.UTC),
+		})
+	}
+	return ranges
+}
+
+// RecentRanges creates open ranges of the last days, the bounds are rounded to the day to keep them cacheable
+func RecentRanges(now time.Time, days ...int) []FacetRange {
+	today := now.UTC().Truncate(24 * time.Hour)
+	ranges := []FacetRange{}
+	for _, d := range days {
+		ranges = append(ranges, FacetRange{
+			Key:  fmt.Sprintf("%dd", d),
+			From: today.AddDate(0, 0, -d),
+		})
+	}
+	return ranges
+}
+
+// DateFacets returns the date facets of the search page
+func DateFacets(now time.Time) map[string]RangeFacet {
+	return map[string]RangeFacet{
+		DateFacetAdded: {
+			Field:  "dateadded",
+			Type:   FacetTypeRange,
+			Ranges: RecentRanges(now, 7, 30, 365),
+		},
+		DateFacetDecade: {
+			Field:  "itemdate",
+			Type:   FacetTypeRange,
+			Ranges: DecadeRanges(dateFacetFirstDecade, now.Year()),
+		},
+		DateFacetYear: {
+			Field:    "itemdate",
+			Type:     FacetTypeDateHistogram,
+			Interval: "year",
+		},
+	}
+}
+
+// RangeFilters creates the filters for the selected range keys (facet name -> key)
+func RangeFilters(facets map[string]RangeFacet, selected map[string]string) ([]RangeFilter, error) {
+	filters := []RangeFilter{}
+	for name, key := range selected {
+		if key == "" {
+			continue
+		}
+		facet, ok := facets[name]
+		if !ok || facet.Type != FacetTypeRange {
+			return nil, fmt.Errorf("unknown range facet '%s'", name)
+		}
+		found := false
+		for _, r := range facet.Ranges {
+			if r.Key == key {
+				filters = append(filters, RangeFilter{Field: facet.Field, From: r.From, To: r.To})
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown range '%s' in facet '%s'", key, name)
+		}
+	}
+	return filters, nil
+}
+
+// dateFacetCount returns the counts of the date facets
+func dateFacetCount(facets map[string]RangeFacet, counts FacetCountResult) FacetCountResult {
+	result := FacetCountResult{}
+	for name := range facets {
+		if c, ok := counts[name]; ok {
+			result[name] = c
+		}
+	}
+	return result
+}
+
+// dateFacetLabel returns the display name of a range
+func dateFacetLabel(facet, key string) string {
+	switch {
+	case facet == DateFacetDecade && key == "before":
+		return fmt.Sprintf("before %d", dateFacetFirstDecade)
+	case facet == DateFacetDecade:
+		return key + "s"
+	case facet == DateFacetAdded:
+		return "last " + strings.TrimSuffix(key, "d") + " days"
+	}
+	return key
+}
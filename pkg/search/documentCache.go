@@ -0,0 +1,85 @@
+package search
+
+import (
+	"github.com/pkg/errors"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	CacheBackendBadger = "badger"
+	CacheBackendLRU    = "lru"
+	CacheBackendNone   = "none"
+)
+
+var ErrCacheMiss = errors.New("document not in cache")
+
+// DocumentCache stores the documents loaded from the search engine
+type DocumentCache interface {
+	// Get returns the document and the time it was stored, ErrCacheMiss if it is not cached or expired.
+	// the document belongs to the caller and does not change the cached one
+	Get(signature string) (*SourceData, time.Time, error)
+	Set(src *SourceData) error
+	Delete(signatures ...string) error
+	DeletePrefix(prefix string) error
+	Clear() error
+	// Sweep removes the expired documents and reclaims their space
+	Sweep() error
+	Stats() CacheStats
+}
+
+type CacheStats struct {
+	Backend   string `json:"backend"`
+	Hits      int64  `json:"hits"`
+	Misses    int64  `json:"misses"`
+	Evictions int64  `json:"evictions"`
+	Expired   int64  `json:"expired"`
+	// -1 if unknown
+	Entries int64 `json:"entries"`
+}
+
+type cacheCounters struct {
+	hits      atomic.Int64
+	misses    atomic.Int64
+	evictions atomic.Int64
+	expired   atomic.Int64
+}
+
+func (cc *cacheCounters) stats(backend string, entries int64) CacheStats {
+	return CacheStats{
+		Backend:   backend,
+		Hits:      cc.hits.Load(),
+		Misses:    cc.misses.Load(),
+		Evictions: cc.evictions.Load(),
+		Expired:   cc.expired.Load(),
+		Entries:   entries,
+	}
+}
+
+// NoopCache caches nothing, every document is loaded from the search engine
+type NoopCache struct {
+	counters cacheCounters
+}
+
+func NewNoopCache() *NoopCache {
+	return &NoopCache{}
+}
+
+func (nc *NoopCache) Get(signature string) (*SourceData, time.Time, error) {
+	nc.counters.misses.Add(1)
+	return nil, time.Time{}, ErrCacheMiss
+}
+
+func (nc *NoopCache) Set(src *SourceData) error { return nil }
+
+func (nc *NoopCache) Delete(signatures ...string) error { return nil }
+
+func (nc *NoopCache) DeletePrefix(prefix string) error { return nil }
+
+func (nc *NoopCache) Clear() error { return nil }
+
+func (nc *NoopCache) Sweep() error { return nil }
+
+func (nc *NoopCache) Stats() CacheStats {
+	return nc.counters.stats(CacheBackendNone, 0)
+}
@@ -0,0 +1,59 @@
+package search
+
+import (
+	"errors"
+	badger "github.com/dgraph-io/badger/v4"
+	"testing"
+	"time"
+)
+
+func TestDocumentCaches(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatalf("cannot open badger: %v", err)
+	}
+	defer db.Close()
+
+	for _, cache := range []DocumentCache{
+		NewLRUCache(2, time.Hour),
+		NewBadgerCache(db, time.Hour),
+	} {
+		for _, sig := range []string{"a-1", "a-2", "b-1"} {
+			if err := cache.Set(&SourceData{Signature: sig, Source: "test", References: []Reference{{Signature: "ref"}}}); err != nil {
+				t.Fatalf("%s: cannot set %s: %v", cache.Stats().Backend, sig, err)
+			}
+		}
+		// changes of a loaded document do not change the cache
+		if doc, _, err := cache.Get("b-1"); err == nil {
+			doc.References[0].Title = "changed"
+		}
+		if err := cache.DeletePrefix("a-"); err != nil {
+			t.Fatalf("%s: cannot delete prefix: %v", cache.Stats().Backend, err)
+		}
+		if doc, _, err := cache.Get("b-1"); err != nil || doc.Signature != "b-1" || doc.References[0].Title != "" {
+			t.Errorf("%s: cannot get b-1: %v", cache.Stats().Backend, err)
+		}
+		if _, _, err := cache.Get("a-2"); !errors.Is(err, ErrCacheMiss) {
+			t.Errorf("%s: a-2 not deleted: %v", cache.Stats().Backend, err)
+		}
+		if err := cache.Sweep(); err != nil {
+			t.Errorf("%s: cannot sweep: %v", cache.Stats().Backend, err)
+		}
+		stats := cache.Stats()
+		if stats.Hits != 2 || stats.Misses != 1 {
+			t.Errorf("%s: wrong counters %+v", stats.Backend, stats)
+		}
+	}
+
+	lru := NewLRUCache(2, time.Millisecond)
+	for _, sig := range []string{"a", "b", "c"} {
+		_ = lru.Set(&SourceData{Signature: sig})
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err := lru.Sweep(); err != nil {
+		t.Fatalf("cannot sweep: %v", err)
+	}
+	if stats := lru.Stats(); stats.Evictions != 1 || stats.Expired != 2 || stats.Entries != 0 {
+		t.Errorf("wrong lru counters %+v", stats)
+	}
+}
@@ -6,16 +6,28 @@ import (
 	"encoding/json"
 	"fmt"
 	elasticsearch8 "github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
 	"github.com/je4/utils/v2/pkg/zLogger"
 	esapi7 "github.com/opensearch-project/opensearch-go/opensearchapi"
 	"github.com/pkg/errors"
 	"io"
 	"log"
+	"net/http"
 	"regexp"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
+const elasticScrollSize = 5000
+
+// keep alive of the point in time between two pages of a scroll
+const elasticPointInTimeKeepAlive = "5m"
+
+// hits of the vector search and the fused ranking at most (index.max_result_window)
+const elasticMaxResultWindow = 10000
+
 type tElasticFieldValue map[string]interface{}
 type tElasticQueryContext map[string]interface{}
 type tElasticFilterContext map[string]interface{}
@@ -47,6 +59,9 @@ type tElasticResultHitsEntry struct {
 	Score     float64             `json:"_score"`
 	Source    SourceData          `json:"_source"`
 	Highlight map[string][]string `json:"highlight,omitempty"`
+	Sort      []interface{}       `json:"sort,omitempty"`
+	// only with explain
+	Explanation json.RawMessage `json:"_explanation,omitempty"`
 }
 
 type tElasticResultHitsTotal struct {
@@ -60,9 +75,34 @@ type tElasticResultHits struct {
 	Hits     []tElasticResultHitsEntry `json:"hits"`
 }
 
+// tElasticBucketKey is a string or the epoch millis of a date_histogram
+type tElasticBucketKey string
+
+func (key *tElasticBucketKey) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*key = tElasticBucketKey(str)
+		return nil
+	}
+	var num json.Number
+	if err := json.Unmarshal(data, &num); err != nil {
+		return errors.Wrapf(err, "invalid bucket key %s", string(data))
+	}
+	*key = tElasticBucketKey(num.String())
+	return nil
+}
+
 type tElasticResultAggregationBucket struct {
-	Key      string `json:"Key"`
-	DocCount int64  `json:"doc_count"`
+	Key         tElasticBucketKey `json:"Key"`
+	KeyAsString string            `json:"key_as_string,omitempty"`
+	DocCount    int64             `json:"doc_count"`
+}
+
+func (bucket *tElasticResultAggregationBucket) value() string {
+	if bucket.KeyAsString != "" {
+		return bucket.KeyAsString
+	}
+	return string(bucket.Key)
 }
 
 type tElasticResultAggregation struct {
@@ -73,14 +113,28 @@ type tElasticResultAggregation struct {
 type tElasticResultAggregations map[string]tElasticResultAggregation
 
 type tElasticSearchResult struct {
-	Error        tElasticResultError        `json:"error,omitempty"`
-	Took         int64                      `json:"took,omitempty"`
-	TimedOut     bool                       `json:"timed_out,omitempty"`
-	Shards       tElasticResultShards       `json:"_shards,omitempty"`
-	Hits         tElasticResultHits         `json:"hits,omitempty"`
-	Aggregations tElasticResultAggregations `json:"aggregations,omitempty"`
-	Status       float64                    `json:"status"`
-	ScrollId     string                     `json:"_scroll_id,omitempty"`
+	Error        tElasticResultError               `json:"error,omitempty"`
+	Took         int64                             `json:"took,omitempty"`
+	TimedOut     bool                              `json:"timed_out,omitempty"`
+	Shards       tElasticResultShards              `json:"_shards,omitempty"`
+	Hits         tElasticResultHits                `json:"hits,omitempty"`
+	Aggregations tElasticResultAggregations        `json:"aggregations,omitempty"`
+	Status       float64                           `json:"status"`
+	PitId        string                            `json:"pit_id,omitempty"`
+	Suggest      map[string][]tElasticSuggestEntry `json:"suggest,omitempty"`
+}
+
+type tElasticSuggestOption struct {
+	Text  string  `json:"text"`
+	Score float64 `json:"score"`
+	Freq  int64   `json:"freq"`
+}
+
+type tElasticSuggestEntry struct {
+	Text    string                  `json:"text"`
+	Offset  int                     `json:"offset"`
+	Length  int                     `json:"length"`
+	Options []tElasticSuggestOption `json:"options"`
 }
 
 type tElasticDeleteResult struct {
@@ -115,12 +169,19 @@ type tElasticMGetResult struct {
 
 type tElasticSearch struct {
 	From           int64                       `json:"from,omitempty"`
-	Size           int64                       `json:"size,omitempty"`
-	Query          *tElasticQuery              `json:"query"`
+	Size           *int64                      `json:"size,omitempty"`
+	Query          *tElasticQuery              `json:"query,omitempty"`
+	Knn            []*tElasticKnn              `json:"knn,omitempty"`
 	Aggregations   *tElasticSearchAggregations `json:"aggs,omitempty"`
 	PostFilter     *tElasticQuery              `json:"post_filter,omitempty"`
 	Highlight      *tElasticHighlight          `json:"highlight,omitempty"`
 	TrackTotalHits bool                        `json:"track_total_hits,omitempty"`
+	Sort           []map[string]interface{}    `json:"sort,omitempty"`
+	SearchAfter    []interface{}               `json:"search_after,omitempty"`
+	PointInTime    *tElasticPointInTime        `json:"pit,omitempty"`
+	Source         []string                    `json:"_source,omitempty"`
+	Suggest        map[string]interface{}      `json:"suggest,omitempty"`
+	Explain        bool                        `json:"explain,omitempty"`
 }
 
 var wordsRegexp = regexp.MustCompile(`([\p{L}\d_]+)+`)
@@ -135,31 +196,93 @@ func (s *tElasticSearch) withTrackTotalHits() *tElasticSearch {
 	s.TrackTotalHits = true
 	return s
 }
+
+// withSize sets the number of hits, also 0 which is omitted by elasticSearch
+func (s *tElasticSearch) withSize(size int64) *tElasticSearch {
+	s.Size = &size
+	return s
+}
+
+func (s *tElasticSearch) withSort(field, order string) *tElasticSearch {
+	s.Sort = append(s.Sort, map[string]interface{}{field: order})
+	return s
+}
+
+// withSortOrder sorts by the criteria of the search, the signature makes the order stable for search_after
+func (s *tElasticSearch) withSortOrder(so SortOrder, lang string) *tElasticSearch {
+	switch field := so.indexField(lang); field {
+	case "":
+		s.withSort("_score", so.order())
+	case "signature":
+	default:
+		// indexes without the field (e.g. before the titlesort mapping) have no sort values
+		s.Sort = append(s.Sort, map[string]interface{}{field: map[string]interface{}{
+			"order":         so.order(),
+			"unmapped_type": "keyword",
+		}})
+	}
+	return s.withSort("signature", so.order())
+}
+func (s *tElasticSearch) withSearchAfter(after []interface{}) *tElasticSearch {
+	s.SearchAfter = after
+	if len(after) > 0 {
+		// search_after replaces from
+		s.From = 0
+	}
+	return s
+}
+func (s *tElasticSearch) withPointInTime(id, keepAlive string) *tElasticSearch {
+	s.PointInTime = &tElasticPointInTime{Id: id, KeepAlive: keepAlive}
+	return s
+}
+func (s *tElasticSearch) withTermSuggest(text string, size int, fields map[string]string) *tElasticSearch {
+	s.Suggest = map[string]interface{}{"text": text}
+	for name, field := range fields {
+		s.Suggest[name] = map[string]interface{}{
+			"term": map[string]interface{}{
+				"field":           field,
+				"suggest_mode":    "always",
+				"size":            size,
+				"max_edits":       spellMaxEdits,
+				"min_word_length": 3,
+			},
+		}
+	}
+	return s
+}
+func (s *tElasticSearch) withSource(fields ...string) *tElasticSearch {
+	s.Source = fields
+	return s
+}
+func (s *tElasticSearch) withKnn(knn ...*tElasticKnn) *tElasticSearch {
+	s.Knn = append(s.Knn, knn...)
+	return s
+}
 func elasticSearch(query *tElasticQuery, aggregations *tElasticSearchAggregations, postfilter *tElasticQuery, highlight *tElasticHighlight, from, size int64) *tElasticSearch {
-	return &tElasticSearch{
+	s := &tElasticSearch{
 		From:         from,
-		Size:         size,
 		Query:        query,
 		Aggregations: aggregations,
 		PostFilter:   postfilter,
 		Highlight:    highlight,
 	}
+	if size > 0 {
+		s.withSize(size)
+	}
+	return s
 }
 
-type tElasticScroll struct {
-	Query *tElasticQuery `json:"query"`
-}
-
-func elasticScroll(query *tElasticQuery) *tElasticScroll {
-	return &tElasticScroll{
-		Query: query,
-	}
+type tElasticPointInTime struct {
+	Id        string `json:"id"`
+	KeepAlive string `json:"keep_alive,omitempty"`
 }
 
 type MTElasticSearch struct {
-	es    *elasticsearch8.Client
-	index string
-	log   zLogger.ZLogger
+	es       *elasticsearch8.Client
+	index    string
+	embedder Embedder
+	ranking  atomic.Pointer[Ranking]
+	log      zLogger.ZLogger
 }
 
 func NewMTElasticSearch(urls []string, index string, apikey string, log zLogger.ZLogger) (*MTElasticSearch, error) {
@@ -175,15 +298,37 @@ func NewMTElasticSearch(urls []string, index string, apikey string, log zLogger.
 		index: index,
 		log:   log,
 	}
+	mte.ranking.Store(DefaultRanking())
 	return mte, nil
 }
 
+// SetRanking replaces the weights of the relevance search, it can be called while searching
+func (mte *MTElasticSearch) SetRanking(r *Ranking) {
+	mte.ranking.Store(r)
+}
+
+// SetEmbedder enables SearchModeSemantic
+func (mte *MTElasticSearch) SetEmbedder(embedder Embedder) {
+	mte.embedder = embedder
+}
+
+func (mte *MTElasticSearch) SearchModes() []SearchMode {
+	if mte.embedder == nil {
+		return []SearchMode{SearchModeLexical}
+	}
+	return []SearchMode{SearchModeLexical, SearchModeSemantic, SearchModeHybrid}
+}
+
 func (mte *MTElasticSearch) Update(source *SourceData) error {
 	return mte.UpdateTimestamp(source, time.Now())
 }
 
 func (mte *MTElasticSearch) UpdateTimestamp(source *SourceData, timestamp time.Time) error {
 	source.Timestamp = timestamp
+	source.ItemDate = normalizeItemDate(source.Date)
+	source.TitleSort = titleSortKeys(source.Title)
+	source.TitleLang = newLangText(source.Title)
+	source.AbstractLang = newLangText(source.Abstract)
 	jsonStr, err := json.Marshal(source)
 	if err != nil {
 		return errors.Wrapf(err, "cannot marshal json")
@@ -231,8 +376,8 @@ func (mte *MTElasticSearch) LoadDocs(ids []string, ctx context.Context) (map[str
 		mte.es.Mget.WithIndex(mte.index),
 		mte.es.Mget.WithContext(ctx),
 	)
-	if err != nil {
-		return nil, errors.Wrapf(err, "cannot search documents %v", jsonstr)
+	if err := elasticRequestError(ctx, res, err); err != nil {
+		return nil, errors.Wrapf(err, "cannot search documents %v", string(jsonstr))
 	}
 	defer res.Body.Close()
 	var mgresult tElasticMGetResult
@@ -240,13 +385,18 @@ func (mte *MTElasticSearch) LoadDocs(ids []string, ctx context.Context) (map[str
 		return nil, errors.Wrap(err, "cannot unmarshal response")
 	}
 	result := make(map[string]*SourceData)
-	for _, doc := range mgresult.Docs {
+	for key := range mgresult.Docs {
+		doc := &mgresult.Docs[key]
 		result[doc.Id] = &doc.Source
 	}
 	return result, nil
 }
 
 func (mte *MTElasticSearch) StatsByACL(catalog []string) (int64, FacetCountResult, error) {
+	return mte.StatsByACLContext(context.Background(), catalog)
+}
+
+func (mte *MTElasticSearch) StatsByACLContext(ctx context.Context, catalog []string) (int64, FacetCountResult, error) {
 	query := elasticQuery()
 	filters := []*tElasticFieldValue{}
 	if len(catalog) > 0 {
@@ -274,11 +424,12 @@ func (mte *MTElasticSearch) StatsByACL(catalog []string) (int64, FacetCountResul
 	mte.log.Debug().Msgf("%v", string(jsonstr))
 	buf := bytes.NewBuffer(jsonstr)
 	res, err := mte.es.Search(
+		mte.es.Search.WithContext(ctx),
 		mte.es.Search.WithIndex(mte.index),
 		mte.es.Search.WithBody(buf),
 		mte.es.Search.WithTrackTotalHits(true),
 	)
-	if err != nil {
+	if err := elasticRequestError(ctx, res, err); err != nil {
 		return 0, nil, errors.Wrapf(err, "cannot query %v", string(jsonstr))
 	}
 	defer res.Body.Close()
@@ -302,58 +453,22 @@ func (mte *MTElasticSearch) StatsByACL(catalog []string) (int64, FacetCountResul
 	for name, agg := range result.Aggregations {
 		fcr[name] = map[string]int{}
 		for _, bucket := range agg.Buckets {
-			fcr[name][bucket.Key] = int(bucket.DocCount)
+			fcr[name][bucket.value()] = int(bucket.DocCount)
 		}
 	}
 	return result.Hits.Total.Value, fcr, nil
 }
 
-func (mte *MTElasticSearch) Scroll(cfg *ScrollConfig, callback func(data *SourceData) error) error {
+func (mte *MTElasticSearch) Scroll(ctx context.Context, cfg *ScrollConfig, callback func(data *SourceData) error) error {
 	query := elasticQuery()
 
-	filters := []*tElasticFieldValue{}
-	if cfg.IsAdmin == false {
-		if len(cfg.Groups) > 0 {
-			filters = append(filters, elasticTermsQuery("acl.meta", 0, cfg.Groups...).FieldValue())
-		}
-	}
-	if cfg.ContentVisible {
-		if len(cfg.Groups) > 0 && !cfg.IsAdmin {
-			filters = append(filters, elasticTermsQuery("acl.content", 0, cfg.Groups...).FieldValue())
-		}
-		filters = append(filters, elasticExistsQuery("mediatype").FieldValue())
+	filters := elasticACLFilters(cfg.Groups, cfg.IsAdmin, cfg.ContentVisible)
+	// the field filters of a scroll are alternatives
+	if fieldFilters := elasticFieldFilters(cfg.FiltersFields); len(fieldFilters) > 0 {
+		filters = append(filters, elasticQuery().withBooleanQuery(elasticBooleanQuery(1.0).withShould(1, fieldFilters...)).FieldValue())
 	}
 
 	matchqueries := []*tElasticFieldValue{}
-	if len(cfg.FiltersFields) > 0 {
-		filters2 := []*tElasticFieldValue{}
-		for fld, vals := range cfg.FiltersFields {
-			for _, val := range vals {
-				switch fld {
-				case "category":
-					filters2 = append(filters2, elasticPrefixQuery(fld, val).FieldValue())
-				case "persons.name":
-					/*
-						filters = append(filters, elasticNestedQuery("persons",
-							elasticQuery().withTermQuery(elasticTermQuery("persons.name.keyword", val, 0))).FieldValue())
-					*/
-					filters2 = append(filters2,
-						elasticNestedQuery("persons", elasticQuery().withBooleanQuery(elasticBooleanQuery(0).withMust(
-							elasticSimpleQueryString(val).
-								withFields([]string{"persons.name.stem"}).
-								withOperatorOR().
-								withAnalyzer("digma_stemmer").
-								FieldValue()))).FieldValue())
-				default:
-					filters2 = append(filters2, elasticTermQuery(fld, val, 0).FieldValue())
-				}
-			}
-		}
-		if len(filters2) > 0 {
-			filters = append(filters, elasticQuery().withBooleanQuery(elasticBooleanQuery(1.0).withShould(1, filters2...)).FieldValue())
-		}
-	}
-
 	qstr := strings.TrimSpace(cfg.QStr)
 	if len(qstr) > 0 {
 		matchqueries = append(matchqueries,
@@ -389,31 +504,48 @@ func (mte *MTElasticSearch) Scroll(cfg *ScrollConfig, callback func(data *Source
 	}
 	query.withBooleanQuery(bq)
 
-	fq := elasticScroll(query)
-
-	// jsonstr, err := json.MarshalIndent(fq, "", "   ")
-	jsonstr, err := json.Marshal(fq)
-	if err != nil {
-		return errors.Wrapf(err, "cannot marshal %v", fq)
-	}
-	mte.log.Debug().Msgf("%v", string(jsonstr))
-	buf := bytes.NewBuffer(jsonstr)
-	res, err := mte.es.Search(
-		mte.es.Search.WithIndex(mte.index),
-		mte.es.Search.WithBody(buf),
-		mte.es.Search.WithSize(5000),
-		mte.es.Search.WithScroll(12*time.Hour),
-	)
+	pitId, err := mte.openPointInTime(ctx)
 	if err != nil {
-		return errors.Wrapf(err, "cannot query %v", string(jsonstr))
+		return err
 	}
+	// the point in time is closed even if the context is cancelled
+	defer func() {
+		if err := mte.closePointInTime(pitId); err != nil {
+			mte.log.Warn().Msgf("cannot close point in time: %v", err)
+		}
+	}()
 
+	// the signature is unique, so it can be used as checkpoint independent of the point in time
+	var after []interface{}
+	if cfg.After != "" {
+		after = []interface{}{cfg.After}
+	}
 	for {
+		if err := ctx.Err(); err != nil {
+			return errors.Wrap(err, "scroll cancelled")
+		}
+		fq := elasticSearch(query, nil, nil, nil, 0, elasticScrollSize).
+			withPointInTime(pitId, elasticPointInTimeKeepAlive).
+			withSort("signature", "asc").
+			withSearchAfter(after)
 
+		jsonstr, err := json.Marshal(fq)
+		if err != nil {
+			return errors.Wrapf(err, "cannot marshal %v", fq)
+		}
+		mte.log.Debug().Msgf("%v", string(jsonstr))
+		// a search with point in time must not name the index
+		res, err := mte.es.Search(
+			mte.es.Search.WithContext(ctx),
+			mte.es.Search.WithBody(bytes.NewBuffer(jsonstr)),
+		)
+		if err := elasticRequestError(ctx, res, err); err != nil {
+			return errors.Wrapf(err, "cannot query %v", string(jsonstr))
+		}
 		var result tElasticSearchResult
 		if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
 			res.Body.Close()
-			return errors.Wrap(err, "cannot unmarshal result")
+			return errors.Wrapf(err, "cannot unmarshal result: %s", res.Status())
 		}
 		res.Body.Close()
 		if res.IsError() {
@@ -426,6 +558,9 @@ func (mte *MTElasticSearch) Scroll(cfg *ScrollConfig, callback func(data *Source
 			)
 			return fmt.Errorf("%s\n%s", errstr, jsonstr)
 		}
+		if result.PitId != "" {
+			pitId = result.PitId
+		}
 
 		for _, sd := range result.Hits.Hits {
 			if err := callback(&sd.Source); err != nil {
@@ -433,89 +568,207 @@ func (mte *MTElasticSearch) Scroll(cfg *ScrollConfig, callback func(data *Source
 			}
 		}
 
-		if len(result.Hits.Hits) == 0 {
+		if len(result.Hits.Hits) < elasticScrollSize {
 			break
 		}
-
-		res, err = mte.es.Scroll(
-			mte.es.Scroll.WithScrollID(result.ScrollId),
-			mte.es.Scroll.WithScroll(1*time.Minute),
-		)
-		if err != nil {
-			return errors.Wrapf(err, "cannot query %v", string(jsonstr))
-		}
+		after = result.Hits.Hits[len(result.Hits.Hits)-1].Sort
 	}
 	return nil
 }
 
-func (mte *MTElasticSearch) Search(cfg *SearchConfig) ([]map[string][]string, []*SourceData, int64, FacetCountResult, error) {
-	query := elasticQuery()
+// openPointInTime opens a point in time on the index for consistent paging
+func (mte *MTElasticSearch) openPointInTime(ctx context.Context) (string, error) {
+	res, err := mte.es.OpenPointInTime(
+		[]string{mte.index},
+		elasticPointInTimeKeepAlive,
+		mte.es.OpenPointInTime.WithContext(ctx),
+	)
+	if err := elasticRequestError(ctx, res, err); err != nil {
+		return "", errors.Wrapf(err, "cannot open point in time on %s", mte.index)
+	}
+	defer res.Body.Close()
+	var result struct {
+		Id    string              `json:"id"`
+		Error tElasticResultError `json:"error,omitempty"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return "", errors.Wrapf(err, "cannot unmarshal point in time: %s", res.Status())
+	}
+	if res.IsError() {
+		return "", errors.Errorf("Elastic error: %v - %v", result.Error.Type, result.Error.Reason)
+	}
+	return result.Id, nil
+}
 
+// closePointInTime releases the resources of the point in time on the server
+func (mte *MTElasticSearch) closePointInTime(pitId string) error {
+	jsonstr, err := json.Marshal(map[string]string{"id": pitId})
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal point in time")
+	}
+	res, err := mte.es.ClosePointInTime(
+		mte.es.ClosePointInTime.WithBody(bytes.NewBuffer(jsonstr)),
+	)
+	if err != nil {
+		return errors.Wrap(err, "cannot close point in time")
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return errors.Errorf("cannot close point in time: %s", res.String())
+	}
+	return nil
+}
+
+// elasticACLFilters restricts the documents to the groups, contentVisible to the documents with visible media
+func elasticACLFilters(groups []string, isAdmin, contentVisible bool) []*tElasticFieldValue {
 	filters := []*tElasticFieldValue{}
-	if cfg.IsAdmin == false {
-		if len(cfg.Groups) > 0 {
-			filters = append(filters, elasticTermsQuery("acl.meta.keyword", 0, cfg.Groups...).FieldValue())
+	if isAdmin == false {
+		if len(groups) > 0 {
+			filters = append(filters, elasticTermsQuery("acl.meta.keyword", 0, groups...).FieldValue())
 		}
 	}
-	if cfg.ContentVisible {
-		if len(cfg.Groups) > 0 && !cfg.IsAdmin {
-			filters = append(filters, elasticTermsQuery("acl.content.keyword", 0, cfg.Groups...).FieldValue())
+	if contentVisible {
+		if len(groups) > 0 && !isAdmin {
+			filters = append(filters, elasticTermsQuery("acl.content.keyword", 0, groups...).FieldValue())
 		}
 		filters = append(filters, elasticExistsQuery("mediatype.keyword").FieldValue())
 	}
+	return filters
+}
 
-	matchqueries := []*tElasticFieldValue{}
-	if len(cfg.FiltersFields) > 0 {
-		for fld, vals := range cfg.FiltersFields {
-			for _, val := range vals {
-				switch fld {
-				case "category":
-					filters = append(filters, elasticPrefixQuery(fld+".keyword", val).FieldValue())
-				case "persons.name":
-					filters = append(filters, elasticNestedQuery("persons",
-						elasticQuery().withTermQuery(elasticTermQuery("persons.name.keyword", val, 0))).FieldValue())
-					/*
-						filters = append(filters,
-							elasticNestedQuery("persons", elasticQuery().withBooleanQuery(elasticBooleanQuery(0).withMust(
-								elasticSimpleQueryString(val).
-									withFields([]string{"persons.name.stem"}).
-									withOperatorOR().
-									withAnalyzer("digma_stemmer").
-									FieldValue()))).FieldValue())
-
-					*/
-				default:
-					filters = append(filters, elasticTermQuery(fld /* +".keyword" */, val, 0).FieldValue())
-				}
+// elasticFieldFilters creates a filter for every value of the fields
+func elasticFieldFilters(filtersFields map[string][]string) []*tElasticFieldValue {
+	filters := []*tElasticFieldValue{}
+	for fld, vals := range filtersFields {
+		for _, val := range vals {
+			switch fld {
+			case "category":
+				filters = append(filters, elasticPrefixQuery(fld+".keyword", val).FieldValue())
+			case "persons.name":
+				filters = append(filters, elasticNestedQuery("persons",
+					elasticQuery().withTermQuery(elasticTermQuery("persons.name.keyword", val, 0))).FieldValue())
+				/*
+					filters = append(filters,
+						elasticNestedQuery("persons", elasticQuery().withBooleanQuery(elasticBooleanQuery(0).withMust(
+							elasticSimpleQueryString(val).
+								withFields([]string{"persons.name.stem"}).
+								withOperatorOR().
+								withAnalyzer("digma_stemmer").
+								FieldValue()))).FieldValue())
+
+				*/
+			default:
+				filters = append(filters, elasticTermQuery(fld /* +".keyword" */, val, 0).FieldValue())
 			}
 		}
 	}
+	return filters
+}
 
+// elasticSearchFilters creates the acl, field and range filters of a search
+func elasticSearchFilters(cfg *SearchConfig) []*tElasticFieldValue {
+	filters := elasticACLFilters(cfg.Groups, cfg.IsAdmin, cfg.ContentVisible)
+	filters = append(filters, elasticFieldFilters(cfg.FiltersFields)...)
+	for _, rf := range cfg.RangeFilters {
+		rq := elasticRangeQuery(rf.Field)
+		if !rf.From.IsZero() {
+			rq.withGte(rf.From.Format(time.RFC3339))
+		}
+		if !rf.To.IsZero() {
+			rq.withLt(rf.To.Format(time.RFC3339))
+		}
+		filters = append(filters, rq.FieldValue())
+	}
+	return filters
+}
+
+/*
+elasticRankingQuery multiplies the score of query with the factors of the ranking:
+documents without media, the recency decay on dateadded and the catalog and mediatype factors
+*/
+func elasticRankingQuery(query *tElasticFieldValue, r *Ranking) *tElasticFunctionScoreQuery {
+	fsq := elasticFunctionScoreQuery(query).withScoreMode("multiply").withBoostMode("multiply")
+	if noMedia := r.noMedia(); noMedia != 1 {
+		fsq.withWeight(elasticTermQuery("hasmedia", false, 0).FieldValue(), noMedia)
+	}
+	if r.Recency.Scale != "" {
+		fsq.withGaussDecay("dateadded", r.Recency.Scale, r.Recency.Offset, r.Recency.Decay)
+	}
+	for _, fld := range []struct {
+		name    string
+		factors map[string]float64
+	}{{"catalog", r.Catalog}, {"mediatype", r.Mediatype}} {
+		values := []string{}
+		for val := range fld.factors {
+			values = append(values, val)
+		}
+		slices.Sort(values)
+		for _, val := range values {
+			fsq.withWeight(elasticTermQuery(fld.name, val, 0).FieldValue(), fld.factors[val])
+		}
+	}
+	return fsq
+}
+
+// knnQueries embeds qstr and searches title_vector and content_vector with the given filters
+func (mte *MTElasticSearch) knnQueries(qstr string, filters []*tElasticFieldValue, k int64) ([]*tElasticKnn, error) {
+	if mte.embedder == nil {
+		return nil, errors.New("no embedder for semantic search")
+	}
+	vector, err := mte.embedder.Embed(qstr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot embed '%s'", qstr)
+	}
+	if k <= 0 {
+		k = 10
+	}
+	return []*tElasticKnn{
+		elasticKnn("title_vector", vector, k).withFilter(filters...),
+		elasticKnn("content_vector", vector, k).withFilter(filters...),
+	}, nil
+}
+
+func (mte *MTElasticSearch) Search(cfg *SearchConfig) ([]map[string][]string, []*SourceData, int64, FacetCountResult, string, error) {
+	return mte.SearchContext(context.Background(), cfg)
+}
+
+func (mte *MTElasticSearch) SearchContext(ctx context.Context, cfg *SearchConfig) ([]map[string][]string, []*SourceData, int64, FacetCountResult, string, error) {
+	start, after, err := searchPage(cfg)
+	if err != nil {
+		return nil, nil, 0, nil, "", err
+	}
+	query := elasticQuery()
+
+	filters := elasticSearchFilters(cfg)
+
+	ranking := mte.ranking.Load()
 	qstr := strings.TrimSpace(cfg.QStr)
-	if len(qstr) > 0 {
-		matchqueries = append(matchqueries,
-			elasticNestedQuery("media.pdf", elasticQuery().withBooleanQuery(elasticBooleanQuery(0).withMust(
-				elasticSimpleQueryString(appendStar(qstr)).
-					withFields([]string{"media.pdf.fulltext^1"}).
-					withOperatorOR().
-					//					withAnalyzer("digma_stemmer").
-					withAnalyzeWildcard().
-					FieldValue()))).FieldValue())
-		matchqueries = append(matchqueries,
-			elasticNestedQuery("persons", elasticQuery().withBooleanQuery(elasticBooleanQuery(0).withMust(
-				elasticSimpleQueryString(appendStar(qstr)).
-					withFields([]string{"persons.name^5"}).
-					withOperatorOR().
-					//					withAnalyzer("digma_stemmer").
-					withAnalyzeWildcard().
-					FieldValue()))).FieldValue())
-		matchqueries = append(matchqueries,
-			elasticSimpleQueryString(appendStar(qstr)).
-				withFields([]string{"title^4", "abstract^3", "notes^3"}).
-				withOperatorOR().
-				//				withAnalyzer("digma_stemmer").
-				withAnalyzeWildcard().
-				FieldValue())
+	semantic := cfg.Mode == SearchModeSemantic && len(qstr) > 0
+	hybrid := cfg.Mode == SearchModeHybrid && len(qstr) > 0
+	// semantic and hybrid hits are ranked by similarity
+	if rankedBySimilarity(cfg.Mode, cfg.QStr) && !cfg.Sort.IsRelevance() {
+		return nil, nil, 0, nil, "", errors.Errorf("sort %s not supported in search mode %s", cfg.Sort, cfg.Mode)
+	}
+	// vector hits are needed up to the end of the page, deeper pages are cut
+	window := start + cfg.Rows
+	if window > elasticMaxResultWindow {
+		window = elasticMaxResultWindow
+	}
+	matchqueries := []*tElasticFieldValue{}
+	if len(qstr) > 0 && !semantic {
+		node, err := ParseQuery(qstr, nil)
+		if err != nil {
+			// the server checks the syntax, search for the words only
+			mte.log.Warn().Msgf("invalid query '%s': %v", qstr, err)
+			words := &QueryBoolNode{}
+			for _, word := range wordsRegexp.FindAllString(qstr, -1) {
+				words.Children = append(words.Children, &QueryTermNode{Value: word})
+			}
+			node = words
+		}
+		if node != nil {
+			matchqueries = append(matchqueries, elasticQueryFromNode(node, cfg.Lang, ranking))
+		}
 	}
 	bq := elasticBooleanQuery(0)
 	if len(matchqueries) > 0 {
@@ -525,20 +778,33 @@ func (mte *MTElasticSearch) Search(cfg *SearchConfig) ([]map[string][]string, []
 		bq.withFilter(filters...)
 	}
 
-	// query.withBooleanQuery(bq)
-	boost := elasticBoostingQuery(
-		elasticQuery().withBooleanQuery(bq).FieldValue(),
-		elasticTermQuery("hasMedia", false, 0.0).FieldValue(),
-		0.5,
-	)
-	query.withBoostingQuery(boost)
+	query.withFunctionScoreQuery(elasticRankingQuery(elasticQuery().withBooleanQuery(bq).FieldValue(), ranking))
 
 	pfterms := []*tElasticFieldValue{}
 	var aggregations *tElasticSearchAggregations
-	if cfg.Facets != nil {
+	if cfg.Facets != nil || len(cfg.RangeFacets) > 0 {
 		aggregations = elasticSearchAggregations()
+		for name, rf := range cfg.RangeFacets {
+			switch rf.Type {
+			case FacetTypeRange:
+				aggregations.AddAggregation(name, elasticSearchAggregation(nil).withDateRange(rf.Field, rf.Ranges))
+			case FacetTypeDateHistogram:
+				aggregations.AddAggregation(name, elasticSearchAggregation(nil).withDateHistogram(rf.Field, rf.Interval))
+			}
+		}
 		for field, vals := range cfg.Facets {
-			aggregations.AddAggregation(field, elasticSearchAggregation(nil).withTerms(field+".keyword", vals.Limit, nil))
+			if vals.Type == FacetTypeHierarchy {
+				// all paths are indexed, only the visible levels are counted
+				limit := vals.Limit
+				if limit <= 0 {
+					limit = hierarchyFacetSize
+				}
+				aggregations.AddAggregation(field, elasticSearchAggregation(nil).
+					withTerms(field+".keyword", limit, nil).
+					withInclude(elasticHierarchyInclude(vals.Selected)))
+			} else {
+				aggregations.AddAggregation(field, elasticSearchAggregation(nil).withTerms(field+".keyword", vals.Limit, nil))
+			}
 			values := []string{}
 			for val, selected := range vals.Selected {
 				if selected {
@@ -567,28 +833,293 @@ func (mte *MTElasticSearch) Search(cfg *SearchConfig) ([]map[string][]string, []
 			withTags([]string{`<span class="highlight">`}, []string{`</span>`})
 	}
 
-	fq := elasticSearch(query, aggregations, postfilter, highlight, int64(cfg.Start), int64(cfg.Rows)).withTrackTotalHits()
+	var knn []*tElasticKnn
+	if semantic || hybrid {
+		var err error
+		knn, err = mte.knnQueries(queryText(qstr), filters, int64(window))
+		if err != nil {
+			return nil, nil, 0, nil, "", errors.Wrap(err, "cannot create vector query")
+		}
+	}
+	if semantic {
+		// ranking by vector similarity only
+		query = nil
+	}
+	if hybrid {
+		return mte.searchHybrid(ctx, cfg, start, window, query, knn, aggregations, postfilter, highlight)
+	}
+
+	fq := elasticSearch(query, aggregations, postfilter, highlight, int64(start), int64(cfg.Rows)).withTrackTotalHits().withKnn(knn...)
+	if semantic && start+cfg.Rows > window {
+		// the vector hits end at the window, a page behind it gets the total and the facets only
+		if start < window {
+			fq.withSize(int64(window - start))
+		} else {
+			fq.From = 0
+			fq.withSize(0)
+		}
+	}
+	if len(knn) == 0 {
+		fq.withSortOrder(cfg.Sort, cfg.Lang).withSearchAfter(after)
+	}
+	result, err := mte.doSearchDebug(ctx, fq, cfg.Debug, "search")
+	if err != nil {
+		return nil, nil, 0, nil, "", err
+	}
+
+	sdarr := []*SourceData{}
+	highlightarr := []map[string][]string{}
+	var lastSort []interface{}
+	for _, sd := range result.Hits.Hits {
+		highlightarr = append(highlightarr, sd.Highlight)
+		x := sd.Source
+		sdarr = append(sdarr, &x)
+		lastSort = sd.Sort
+	}
+	next, err := nextSearchCursor(cfg, start, len(sdarr), result.Hits.Total.Value, lastSort)
+	if err != nil {
+		return nil, nil, 0, nil, "", err
+	}
+	return highlightarr, sdarr, result.Hits.Total.Value, elasticFacetCountResult(result), next, nil
+}
+
+/*
+searchHybrid runs the lexical and the vector query for all hits up to window and fuses both rankings.
+facets and highlights come from the lexical query.
+the total is an estimate: the lexical hits and the vector hits of the window which are not part of the lexical window
+*/
+func (mte *MTElasticSearch) searchHybrid(
+	ctx context.Context,
+	cfg *SearchConfig,
+	start int,
+	window int,
+	query *tElasticQuery,
+	knn []*tElasticKnn,
+	aggregations *tElasticSearchAggregations,
+	postfilter *tElasticQuery,
+	highlight *tElasticHighlight) ([]map[string][]string, []*SourceData, int64, FacetCountResult, string, error) {
+	lexical, err := mte.doSearchDebug(ctx, elasticSearch(query, aggregations, postfilter, highlight, 0, int64(window)).withTrackTotalHits(), cfg.Debug, "lexical")
+	if err != nil {
+		return nil, nil, 0, nil, "", errors.Wrap(err, "cannot execute lexical query")
+	}
+	vector, err := mte.doSearchDebug(ctx, elasticSearch(nil, nil, postfilter, nil, 0, int64(window)).withKnn(knn...), cfg.Debug, "vector")
+	if err != nil {
+		return nil, nil, 0, nil, "", errors.Wrap(err, "cannot execute vector query")
+	}
+
+	hits := map[string]tElasticResultHitsEntry{}
+	lexicalIds := []string{}
+	for _, hit := range lexical.Hits.Hits {
+		hits[hit.Id] = hit
+		lexicalIds = append(lexicalIds, hit.Id)
+	}
+	vectorIds := []string{}
+	var vectorOnly int64
+	for _, hit := range vector.Hits.Hits {
+		if _, ok := hits[hit.Id]; !ok {
+			hits[hit.Id] = hit
+			vectorOnly++
+		}
+		vectorIds = append(vectorIds, hit.Id)
+	}
+	fused := reciprocalRankFusion(rrfRankConstant, lexicalIds, vectorIds)
+
+	sdarr := []*SourceData{}
+	highlightarr := []map[string][]string{}
+	for i := start; i < len(fused) && i < window; i++ {
+		hit := hits[fused[i]]
+		highlightarr = append(highlightarr, hit.Highlight)
+		x := hit.Source
+		sdarr = append(sdarr, &x)
+	}
+	// vector hits which are not part of the lexical window are counted as additional hits
+	total := lexical.Hits.Total.Value + vectorOnly
+	// the fused ranking has no sort values, the cursor continues with the offset up to the window
+	cursorTotal := total
+	if cursorTotal > elasticMaxResultWindow {
+		cursorTotal = elasticMaxResultWindow
+	}
+	next, err := nextSearchCursor(cfg, start, len(sdarr), cursorTotal, nil)
+	if err != nil {
+		return nil, nil, 0, nil, "", err
+	}
+	return highlightarr, sdarr, total, elasticFacetCountResult(lexical), next, nil
+}
 
+/*
+Related returns the documents which are similar to doc: shared persons, tags and categories and similar title and abstract.
+the acl and field filters of cfg are applied, doc itself is not part of the result
+*/
+func (mte *MTElasticSearch) Related(ctx context.Context, doc *SourceData, cfg *SearchConfig) ([]*SourceData, error) {
+	should := []*tElasticFieldValue{
+		elasticMoreLikeThisQuery([]string{"title.stem", "abstract.stem"}, mte.index, doc.Signature).
+			withTermFrequencies(1, 2, relatedMaxTerms).
+			FieldValue(),
+	}
+	if persons := relatedPersons(doc); len(persons) > 0 {
+		should = append(should, elasticNestedQuery("persons",
+			elasticQuery().withTermsQuery(elasticTermsQuery("persons.name.keyword", 3, persons...))).FieldValue())
+	}
+	if len(doc.Tags) > 0 {
+		should = append(should, elasticTermsQuery("tags.keyword", 1, doc.Tags...).FieldValue())
+	}
+	if categories := relatedCategories(doc.Category); len(categories) > 0 {
+		should = append(should, elasticTermsQuery("category", 2, categories...).FieldValue())
+	}
+	bq := elasticBooleanQuery(0).
+		withShould(1, should...).
+		withMustNot(elasticIdsQuery(doc.Signature).FieldValue())
+	if filters := elasticSearchFilters(cfg); len(filters) > 0 {
+		bq.withFilter(filters...)
+	}
+	result, err := mte.doSearch(ctx, elasticSearch(elasticQuery().withBooleanQuery(bq), nil, nil, nil, 0, int64(cfg.Rows)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot search documents related to %s", doc.Signature)
+	}
+	sdarr := []*SourceData{}
+	for _, hit := range result.Hits.Hits {
+		x := hit.Source
+		sdarr = append(sdarr, &x)
+	}
+	return sdarr, nil
+}
+
+/*
+Suggest completes the text in cfg.QStr with titles, persons, tags and categories of the documents visible with cfg.
+the suggest subfields are indexed with edge ngrams
+*/
+func (mte *MTElasticSearch) Suggest(ctx context.Context, cfg *SearchConfig) ([]Suggestion, error) {
+	text := strings.TrimSpace(cfg.QStr)
+	if text == "" {
+		return []Suggestion{}, nil
+	}
+	should := []*tElasticFieldValue{
+		elasticMatchQuery("title.suggest", text).withOperatorAND().FieldValue(),
+		elasticNestedQuery("persons", elasticQuery().withMatchQuery(
+			elasticMatchQuery("persons.name.suggest", text).withOperatorAND())).FieldValue(),
+		elasticMatchQuery("tags.suggest", text).withOperatorAND().FieldValue(),
+		elasticMatchQuery("category.suggest", text).withOperatorAND().FieldValue(),
+	}
+	bq := elasticBooleanQuery(0).withShould(1, should...)
+	if filters := elasticSearchFilters(cfg); len(filters) > 0 {
+		bq.withFilter(filters...)
+	}
+	fq := elasticSearch(elasticQuery().withBooleanQuery(bq), nil, nil, nil, 0, suggestDocs).
+		withSource("title", "persons", "tags", "category")
+	result, err := mte.doSearch(ctx, fq)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot search suggestions for '%s'", text)
+	}
+	docs := []*SourceData{}
+	for _, hit := range result.Hits.Hits {
+		x := hit.Source
+		docs = append(docs, &x)
+	}
+	return collectSuggestions(docs, text, cfg.Rows), nil
+}
+
+/*
+DidYouMean corrects the words of cfg.QStr with the terms of titles, persons and tags.
+only corrected queries with hits for the filters of cfg are returned
+*/
+func (mte *MTElasticSearch) DidYouMean(ctx context.Context, cfg *SearchConfig) ([]SpellSuggestion, error) {
+	words := wordsRegexp.FindAllString(strings.ToLower(queryText(cfg.QStr)), -1)
+	if len(words) == 0 {
+		return []SpellSuggestion{}, nil
+	}
+	fq := elasticSearch(nil, nil, nil, nil, 0, 0).withSize(0).withTermSuggest(strings.Join(words, " "), 3, map[string]string{
+		"title":   "title",
+		"persons": "persons.name",
+		"tags":    "tags",
+	})
+	result, err := mte.doSearch(ctx, fq)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot get spelling suggestions for '%s'", cfg.QStr)
+	}
+	options := map[string][]spellOption{}
+	for _, entries := range result.Suggest {
+		for _, entry := range entries {
+			for _, opt := range entry.Options {
+				options[entry.Text] = append(options[entry.Text], spellOption{Text: opt.Text, Score: opt.Score, Freq: opt.Freq})
+			}
+		}
+	}
+	return spellSuggestions(cfg.QStr, options, spellCount(ctx, cfg, mte.SearchContext))
+}
+
+/*
+elasticRequestError returns the error of a request which got no regular answer:
+the error of the context if it is done, ErrUnavailable if elastic cannot be reached or is overloaded
+*/
+func elasticRequestError(ctx context.Context, res *esapi.Response, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		if res != nil {
+			res.Body.Close()
+		}
+		return ctxErr
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	if res.StatusCode == http.StatusServiceUnavailable || res.StatusCode == http.StatusTooManyRequests {
+		res.Body.Close()
+		return fmt.Errorf("%w: %s", ErrUnavailable, res.Status())
+	}
+	return nil
+}
+
+/*
+doSearchDebug runs the query with explain if debug is set and adds the query,
+the scores and the explanations of the hits to debug
+*/
+func (mte *MTElasticSearch) doSearchDebug(ctx context.Context, fq *tElasticSearch, debug *SearchDebug, name string) (*tElasticSearchResult, error) {
+	if debug == nil {
+		return mte.doSearch(ctx, fq)
+	}
+	fq.Explain = true
+	result, err := mte.doSearch(ctx, fq)
+	if err != nil {
+		return nil, err
+	}
+	debug.Engine = "elastic"
+	dq, err := debug.addQuery(name, fq, time.Duration(result.Took)*time.Millisecond)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshal query for debugging")
+	}
+	for _, hit := range result.Hits.Hits {
+		var explanation interface{}
+		if len(hit.Explanation) > 0 {
+			explanation = hit.Explanation
+		}
+		if err := dq.addHit(hit.Id, hit.Score, explanation); err != nil {
+			return nil, errors.Wrapf(err, "cannot marshal explanation of %s", hit.Id)
+		}
+	}
+	return result, nil
+}
+
+func (mte *MTElasticSearch) doSearch(ctx context.Context, fq *tElasticSearch) (*tElasticSearchResult, error) {
 	// jsonstr, err := json.MarshalIndent(fq, "", "   ")
 	jsonstr, err := json.Marshal(fq)
 	if err != nil {
-		return nil, nil, 0, nil, errors.Wrapf(err, "cannot marshal %v", fq)
+		return nil, errors.Wrapf(err, "cannot marshal %v", fq)
 	}
 	mte.log.Debug().Msgf("%v", string(jsonstr))
 	buf := bytes.NewBuffer(jsonstr)
 	res, err := mte.es.Search(
+		mte.es.Search.WithContext(ctx),
 		mte.es.Search.WithIndex(mte.index),
 		mte.es.Search.WithBody(buf),
-		mte.es.Search.WithTrackTotalHits(true),
+		mte.es.Search.WithTrackTotalHits(fq.TrackTotalHits),
 	)
-	if err != nil {
-		return nil, nil, 0, nil, errors.Wrapf(err, "cannot query %v", string(jsonstr))
+	if err := elasticRequestError(ctx, res, err); err != nil {
+		return nil, errors.Wrapf(err, "cannot query %v", string(jsonstr))
 	}
 	defer res.Body.Close()
 
-	var result tElasticSearchResult
-	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
-		return nil, nil, 0, nil, errors.Wrap(err, "cannot unmarshal result")
+	var result = &tElasticSearchResult{}
+	if err := json.NewDecoder(res.Body).Decode(result); err != nil {
+		return nil, errors.Wrap(err, "cannot unmarshal result")
 	}
 	if res.IsError() {
 		errstr := fmt.Sprintf(
@@ -598,27 +1129,27 @@ func (mte *MTElasticSearch) Search(cfg *SearchConfig) ([]map[string][]string, []
 			result.Error.CausedBy.Line,
 			result.Error.CausedBy.Col,
 		)
-		return nil, nil, 0, nil, fmt.Errorf("%s\n%s", errstr, jsonstr)
+		return nil, fmt.Errorf("%s\n%s", errstr, jsonstr)
 	}
+	return result, nil
+}
 
-	sdarr := []*SourceData{}
-	highlightarr := []map[string][]string{}
-	for _, sd := range result.Hits.Hits {
-		highlightarr = append(highlightarr, sd.Highlight)
-		x := sd.Source
-		sdarr = append(sdarr, &x)
-	}
+func elasticFacetCountResult(result *tElasticSearchResult) FacetCountResult {
 	var fcr FacetCountResult = make(FacetCountResult)
 	for name, agg := range result.Aggregations {
 		fcr[name] = map[string]int{}
 		for _, bucket := range agg.Buckets {
-			fcr[name][bucket.Key] = int(bucket.DocCount)
+			fcr[name][bucket.value()] = int(bucket.DocCount)
 		}
 	}
-	return highlightarr, sdarr, result.Hits.Total.Value, fcr, nil
+	return fcr
 }
 
 func (mte *MTElasticSearch) LastUpdate(cfg *ScrollConfig) (time.Time, error) {
+	return mte.LastUpdateContext(context.Background(), cfg)
+}
+
+func (mte *MTElasticSearch) LastUpdateContext(ctx context.Context, cfg *ScrollConfig) (time.Time, error) {
 	var lastUpdate time.Time
 
 	query := elasticQuery()
@@ -692,7 +1223,8 @@ func (mte *MTElasticSearch) LastUpdate(cfg *ScrollConfig) (time.Time, error) {
 	}
 	query.withBooleanQuery(bq)
 
-	fq := elasticSearch(query, nil, nil, nil, 0, 1)
+	// the newest document
+	fq := elasticSearch(query, nil, nil, nil, 0, 1).withSort("timestamp", "desc")
 
 	jsonstr, err := json.Marshal(fq)
 	if err != nil {
@@ -701,10 +1233,11 @@ func (mte *MTElasticSearch) LastUpdate(cfg *ScrollConfig) (time.Time, error) {
 	mte.log.Debug().Msgf("%v", string(jsonstr))
 	buf := bytes.NewBuffer(jsonstr)
 	res, err := mte.es.Search(
+		mte.es.Search.WithContext(ctx),
 		mte.es.Search.WithIndex(mte.index),
 		mte.es.Search.WithBody(buf),
 	)
-	if err != nil {
+	if err := elasticRequestError(ctx, res, err); err != nil {
 		return lastUpdate, errors.Wrapf(err, "cannot query %v", string(jsonstr))
 	}
 	defer res.Body.Close()
@@ -731,6 +1264,10 @@ func (mte *MTElasticSearch) LastUpdate(cfg *ScrollConfig) (time.Time, error) {
 }
 
 func (mte *MTElasticSearch) Delete(cfg *ScrollConfig) (int64, error) {
+	return mte.DeleteContext(context.Background(), cfg)
+}
+
+func (mte *MTElasticSearch) DeleteContext(ctx context.Context, cfg *ScrollConfig) (int64, error) {
 	query := elasticQuery()
 
 	filters := []*tElasticFieldValue{}
@@ -810,8 +1347,8 @@ func (mte *MTElasticSearch) Delete(cfg *ScrollConfig) (int64, error) {
 	}
 	mte.log.Debug().Msgf("%v", string(jsonstr))
 	buf := bytes.NewBuffer(jsonstr)
-	dbq, err := mte.es.DeleteByQuery([]string{mte.index}, buf)
-	if err != nil {
+	dbq, err := mte.es.DeleteByQuery([]string{mte.index}, buf, mte.es.DeleteByQuery.WithContext(ctx))
+	if err := elasticRequestError(ctx, dbq, err); err != nil {
 		return 0, errors.Wrapf(err, "cannot query %v", string(jsonstr))
 	}
 	defer dbq.Body.Close()
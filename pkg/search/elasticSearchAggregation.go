@@ -1,8 +1,19 @@
 package search
 
+import "time"
+
 type tElasticSearchAggregation struct {
-	Terms        map[string]interface{}      `json:"terms,omitempty"`
-	Aggregations *tElasticSearchAggregations `json:"aggs,omitempty"`
+	Terms         map[string]interface{}      `json:"terms,omitempty"`
+	DateRange     map[string]interface{}      `json:"date_range,omitempty"`
+	DateHistogram map[string]interface{}      `json:"date_histogram,omitempty"`
+	Aggregations  *tElasticSearchAggregations `json:"aggs,omitempty"`
+}
+
+// formats of the histogram keys in FacetCountResult
+var elasticDateHistogramFormats = map[string]string{
+	"year":  "yyyy",
+	"month": "yyyy-MM",
+	"day":   "yyyy-MM-dd",
 }
 
 func (esa *tElasticSearchAggregation) withTerms(field string, size int64, order map[string]string) *tElasticSearchAggregation {
@@ -17,6 +28,45 @@ func (esa *tElasticSearchAggregation) withTerms(field string, size int64, order
 	}
 	return esa
 }
+
+func (esa *tElasticSearchAggregation) withInclude(include string) *tElasticSearchAggregation {
+	if esa.Terms != nil {
+		esa.Terms["include"] = include
+	}
+	return esa
+}
+
+func (esa *tElasticSearchAggregation) withDateRange(field string, ranges []FacetRange) *tElasticSearchAggregation {
+	rs := []map[string]interface{}{}
+	for _, r := range ranges {
+		rv := map[string]interface{}{"key": r.Key}
+		if !r.From.IsZero() {
+			rv["from"] = r.From.Format(time.RFC3339)
+		}
+		if !r.To.IsZero() {
+			rv["to"] = r.To.Format(time.RFC3339)
+		}
+		rs = append(rs, rv)
+	}
+	esa.DateRange = map[string]interface{}{
+		"field":  field,
+		"ranges": rs,
+	}
+	return esa
+}
+
+func (esa *tElasticSearchAggregation) withDateHistogram(field string, interval string) *tElasticSearchAggregation {
+	esa.DateHistogram = map[string]interface{}{
+		"field":             field,
+		"calendar_interval": interval,
+		"min_doc_count":     1,
+	}
+	if format, ok := elasticDateHistogramFormats[interval]; ok {
+		esa.DateHistogram["format"] = format
+	}
+	return esa
+}
+
 func elasticSearchAggregation(aggregations *tElasticSearchAggregations) *tElasticSearchAggregation {
 	return &tElasticSearchAggregation{
 		Aggregations: aggregations,
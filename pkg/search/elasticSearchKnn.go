@@ -0,0 +1,40 @@
+package search
+
+type tElasticKnn struct {
+	Field         string                `json:"field"`
+	QueryVector   []float32             `json:"query_vector"`
+	K             int64                 `json:"k"`
+	NumCandidates int64                 `json:"num_candidates"`
+	Filter        []*tElasticFieldValue `json:"filter,omitempty"`
+	Boost         float64               `json:"boost,omitempty"`
+}
+
+func (ek *tElasticKnn) withFilter(filters ...*tElasticFieldValue) *tElasticKnn {
+	ek.Filter = append(ek.Filter, filters...)
+	return ek
+}
+
+func (ek *tElasticKnn) withBoost(boost float64) *tElasticKnn {
+	ek.Boost = boost
+	return ek
+}
+
+// num_candidates must not be smaller than k
+func elasticKnn(field string, vector []float32, k int64) *tElasticKnn {
+	candidates := k * 10
+	if candidates < 100 {
+		candidates = 100
+	}
+	if candidates > 10000 {
+		candidates = 10000
+	}
+	if candidates < k {
+		candidates = k
+	}
+	return &tElasticKnn{
+		Field:         field,
+		QueryVector:   vector,
+		K:             k,
+		NumCandidates: candidates,
+	}
+}
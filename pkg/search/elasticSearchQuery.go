@@ -83,6 +83,42 @@ func elasticBoostingQuery(positive, negative *tElasticFieldValue, negativeBoost
 	}
 }
 
+/*
+Function Score Query
+https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-function-score-query.html
+*/
+type tElasticFunctionScoreQuery map[string]interface{}
+
+func (q *tElasticFunctionScoreQuery) withFunction(function tElasticFieldValue) *tElasticFunctionScoreQuery {
+	functions, _ := (*q)["functions"].([]tElasticFieldValue)
+	(*q)["functions"] = append(functions, function)
+	return q
+}
+func (q *tElasticFunctionScoreQuery) withWeight(filter *tElasticFieldValue, weight float64) *tElasticFunctionScoreQuery {
+	return q.withFunction(tElasticFieldValue{"filter": filter, "weight": weight})
+}
+func (q *tElasticFunctionScoreQuery) withGaussDecay(field, scale, offset string, decay float64) *tElasticFunctionScoreQuery {
+	params := tElasticFieldValue{"scale": scale, "decay": decay}
+	if offset != "" {
+		params["offset"] = offset
+	}
+	return q.withFunction(tElasticFieldValue{"gauss": tElasticFieldValue{field: params}})
+}
+func (q *tElasticFunctionScoreQuery) withScoreMode(scoreMode string) *tElasticFunctionScoreQuery {
+	(*q)["score_mode"] = scoreMode
+	return q
+}
+func (q *tElasticFunctionScoreQuery) withBoostMode(boostMode string) *tElasticFunctionScoreQuery {
+	(*q)["boost_mode"] = boostMode
+	return q
+}
+func (q *tElasticFunctionScoreQuery) FieldValue() *tElasticFieldValue {
+	return &tElasticFieldValue{"function_score": q}
+}
+func elasticFunctionScoreQuery(query *tElasticFieldValue) *tElasticFunctionScoreQuery {
+	return &tElasticFunctionScoreQuery{"query": query}
+}
+
 /*
 Disjunction Max Query
 https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-dis-max-query.html
@@ -118,6 +154,52 @@ func elasticPrefixQuery(field, value string) *tElasticPrefixQuery {
 	}
 }
 
+/*
+Wildcard Query
+https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-wildcard-query.html
+*/
+type tElasticWildcardQuery map[string]interface{}
+
+func (q *tElasticWildcardQuery) FieldValue() *tElasticFieldValue {
+	return &tElasticFieldValue{"wildcard": q}
+}
+func elasticWildcardQuery(field, value string) *tElasticWildcardQuery {
+	return &tElasticWildcardQuery{
+		field: tElasticFieldValue{"value": value, "case_insensitive": true},
+	}
+}
+
+/*
+Range Query
+https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-range-query.html
+*/
+type tElasticRangeQuery map[string]tElasticFieldValue
+
+func (q *tElasticRangeQuery) withBound(op string, value interface{}) *tElasticRangeQuery {
+	for _, fv := range *q {
+		fv[op] = value
+	}
+	return q
+}
+func (q *tElasticRangeQuery) withGte(value interface{}) *tElasticRangeQuery {
+	return q.withBound("gte", value)
+}
+func (q *tElasticRangeQuery) withGt(value interface{}) *tElasticRangeQuery {
+	return q.withBound("gt", value)
+}
+func (q *tElasticRangeQuery) withLte(value interface{}) *tElasticRangeQuery {
+	return q.withBound("lte", value)
+}
+func (q *tElasticRangeQuery) withLt(value interface{}) *tElasticRangeQuery {
+	return q.withBound("lt", value)
+}
+func (q *tElasticRangeQuery) FieldValue() *tElasticFieldValue {
+	return &tElasticFieldValue{"range": q}
+}
+func elasticRangeQuery(field string) *tElasticRangeQuery {
+	return &tElasticRangeQuery{field: tElasticFieldValue{}}
+}
+
 /*
 Constant Score Query
 https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-constant-score-query.html#query-dsl-constant-score-query
@@ -217,25 +299,29 @@ https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-match-
 */
 type tElasticMatchQuery map[string]interface{}
 
-func (q *tElasticMatchQuery) withAnalyzer(analyzer string) *tElasticMatchQuery {
-	(*q)["analyzer"] = analyzer
+// withOption sets a parameter of the match query, they belong to the field
+func (q *tElasticMatchQuery) withOption(key string, value interface{}) *tElasticMatchQuery {
+	for _, v := range *q {
+		if fv, ok := v.(tElasticFieldValue); ok {
+			fv[key] = value
+		}
+	}
 	return q
 }
+func (q *tElasticMatchQuery) withAnalyzer(analyzer string) *tElasticMatchQuery {
+	return q.withOption("analyzer", analyzer)
+}
 func (q *tElasticMatchQuery) withFuzziness(fuzziness string) *tElasticMatchQuery {
-	(*q)["fuzziness"] = fuzziness
-	return q
+	return q.withOption("fuzziness", fuzziness)
 }
 func (q *tElasticMatchQuery) withOperatorAND() *tElasticMatchQuery {
-	(*q)["operator"] = "AND"
-	return q
+	return q.withOption("operator", "AND")
 }
 func (q *tElasticMatchQuery) withOperatorOR() *tElasticMatchQuery {
-	(*q)["operator"] = "OR"
-	return q
+	return q.withOption("operator", "OR")
 }
 func (q *tElasticMatchQuery) withNoAutoGenerateSynonymsPhraseQuery() *tElasticMatchQuery {
-	(*q)["auto_generate_synonyms_phrase_query"] = false
-	return q
+	return q.withOption("auto_generate_synonyms_phrase_query", false)
 }
 func (q *tElasticMatchQuery) FieldValue() *tElasticFieldValue {
 	return &tElasticFieldValue{"match": q}
@@ -291,6 +377,43 @@ func elasticMatchNoneQuery() *tElasticMatchNoneQuery {
 	return &tElasticMatchNoneQuery{}
 }
 
+/*
+More like this query
+https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-mlt-query.html
+*/
+type tElasticMoreLikeThisQuery map[string]interface{}
+
+func (q *tElasticMoreLikeThisQuery) withTermFrequencies(minTermFreq, minDocFreq, maxQueryTerms int) *tElasticMoreLikeThisQuery {
+	(*q)["min_term_freq"] = minTermFreq
+	(*q)["min_doc_freq"] = minDocFreq
+	(*q)["max_query_terms"] = maxQueryTerms
+	return q
+}
+func (q *tElasticMoreLikeThisQuery) FieldValue() *tElasticFieldValue {
+	return &tElasticFieldValue{"more_like_this": q}
+}
+func elasticMoreLikeThisQuery(fields []string, index, id string) *tElasticMoreLikeThisQuery {
+	return &tElasticMoreLikeThisQuery{
+		"fields": fields,
+		"like":   []tElasticFieldValue{{"_index": index, "_id": id}},
+	}
+}
+
+/*
+Ids query
+https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-ids-query.html
+*/
+type tElasticIdsQuery map[string]interface{}
+
+func (q *tElasticIdsQuery) FieldValue() *tElasticFieldValue {
+	return &tElasticFieldValue{"ids": q}
+}
+func elasticIdsQuery(ids ...string) *tElasticIdsQuery {
+	return &tElasticIdsQuery{
+		"values": ids,
+	}
+}
+
 /*
 Query
 https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl.html
@@ -313,6 +436,10 @@ func (q *tElasticQuery) withBoostingQuery(bq *tElasticBoostingQuery) *tElasticQu
 	(*q)["boosting"] = bq
 	return q
 }
+func (q *tElasticQuery) withFunctionScoreQuery(fq *tElasticFunctionScoreQuery) *tElasticQuery {
+	(*q)["function_score"] = fq
+	return q
+}
 func (q *tElasticQuery) withTermsQuery(bq *tElasticTermsQuery) *tElasticQuery {
 	(*q)["terms"] = bq
 	return q
@@ -0,0 +1,212 @@
+package search
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// fields which are searched with the analyzer instead of exact terms
+var elasticTextFields = map[string]bool{
+	"title":    true,
+	"abstract": true,
+	"notes":    true,
+}
+
+// ranges of the free text date compare the normalized item date
+const elasticDateRangeField = "itemdate"
+
+// fields of the default search which have language subfields
+var elasticLangFields = []string{"title", "abstract"}
+
+// elasticBoostedField returns the field with the boost of the ranking (e.g. "title^4")
+func elasticBoostedField(field string, r *Ranking) string {
+	return fmt.Sprintf("%s^%v", field, r.boost(field))
+}
+
+// elasticFulltextQuery searches text in all fields of the default search, lang adds the language subfields
+func elasticFulltextQuery(text, lang string, r *Ranking) *tElasticFieldValue {
+	fields := []string{elasticBoostedField("title", r), elasticBoostedField("abstract", r), elasticBoostedField("notes", r)}
+	fields = append(fields, langFields("title", r.boost("title"), lang)...)
+	fields = append(fields, langFields("abstract", r.boost("abstract"), lang)...)
+	return elasticQuery().withBooleanQuery(elasticBooleanQuery(0).withShould(1,
+		elasticNestedQuery("media.pdf", elasticQuery().withBooleanQuery(elasticBooleanQuery(0).withMust(
+			elasticSimpleQueryString(text).
+				withFields([]string{elasticBoostedField("media.pdf.fulltext", r)}).
+				withOperatorOR().
+				withAnalyzeWildcard().
+				FieldValue()))).FieldValue(),
+		elasticNestedQuery("persons", elasticQuery().withBooleanQuery(elasticBooleanQuery(0).withMust(
+			elasticSimpleQueryString(text).
+				withFields([]string{elasticBoostedField("persons.name", r)}).
+				withOperatorOR().
+				withAnalyzeWildcard().
+				FieldValue()))).FieldValue(),
+		elasticSimpleQueryString(text).
+			withFields(fields).
+			withOperatorOR().
+			withAnalyzeWildcard().
+			FieldValue(),
+	)).FieldValue()
+}
+
+// simple_query_string syntax of a term
+func elasticTermText(term *QueryTermNode) string {
+	switch {
+	case term.Phrase:
+		return `"` + strings.ReplaceAll(term.Value, `"`, `\"`) + `"`
+	case term.Wildcard:
+		return term.Value
+	default:
+		return appendStar(term.Value)
+	}
+}
+
+func elasticFieldQuery(term *QueryTermNode, lang string) *tElasticFieldValue {
+	switch {
+	case term.Field == "persons.name":
+		return elasticNestedQuery("persons", elasticQuery().withBooleanQuery(elasticBooleanQuery(0).withMust(
+			elasticSimpleQueryString(elasticTermText(term)).
+				withFields([]string{"persons.name"}).
+				withOperatorAND().
+				withAnalyzeWildcard().
+				FieldValue()))).FieldValue()
+	case elasticTextFields[term.Field]:
+		fields := []string{term.Field}
+		if slices.Contains(elasticLangFields, term.Field) {
+			fields = append(fields, langFields(term.Field, 1, lang)...)
+		}
+		return elasticSimpleQueryString(elasticTermText(term)).
+			withFields(fields).
+			withOperatorAND().
+			withAnalyzeWildcard().
+			FieldValue()
+	case term.Wildcard:
+		return elasticWildcardQuery(term.Field, term.Value).FieldValue()
+	case term.Field == "category":
+		return elasticPrefixQuery(term.Field+".keyword", term.Value).FieldValue()
+	default:
+		return elasticTermQuery(term.Field, term.Value, 0).FieldValue()
+	}
+}
+
+// layouts of the date bounds with the length of the period they cover
+var itemDatePeriods = []struct {
+	layout              string
+	years, months, days int
+}{
+	{"2006-01-02", 0, 0, 1},
+	{"2006-01", 0, 1, 0},
+	{"2006", 1, 0, 0},
+}
+
+// itemDatePeriod returns the begin and the end (exclusive) of the period of a date bound like "1990" or "1990-05"
+func itemDatePeriod(str string) (time.Time, time.Time, bool) {
+	for _, p := range itemDatePeriods {
+		if t, err := time.Parse(p.layout, str); err == nil {
+			return t, t.AddDate(p.years, p.months, p.days), true
+		}
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+/*
+elasticRangeFieldQuery creates a range query.
+the date compares the item date, so bounds cover whole periods: date:[1990 TO 1990] contains "1990-05-01".
+other bounds like "now-10y" are left to elasticsearch
+*/
+func elasticRangeFieldQuery(rng *QueryRangeNode) *tElasticFieldValue {
+	field := rng.Field
+	if field == "date" {
+		rq := elasticRangeQuery(elasticDateRangeField)
+		if rng.From != "*" {
+			if begin, end, ok := itemDatePeriod(rng.From); !ok {
+				rq.withGte(rng.From)
+			} else if rng.IncludeLower {
+				rq.withGte(begin.Format("2006-01-02"))
+			} else {
+				rq.withGte(end.Format("2006-01-02"))
+			}
+		}
+		if rng.To != "*" {
+			if begin, end, ok := itemDatePeriod(rng.To); !ok {
+				rq.withLt(rng.To)
+			} else if rng.IncludeUpper {
+				rq.withLt(end.Format("2006-01-02"))
+			} else {
+				rq.withLt(begin.Format("2006-01-02"))
+			}
+		}
+		return rq.FieldValue()
+	}
+	rq := elasticRangeQuery(field)
+	if rng.From != "*" {
+		if rng.IncludeLower {
+			rq.withGte(rng.From)
+		} else {
+			rq.withGt(rng.From)
+		}
+	}
+	if rng.To != "*" {
+		if rng.IncludeUpper {
+			rq.withLte(rng.To)
+		} else {
+			rq.withLt(rng.To)
+		}
+	}
+	return rq.FieldValue()
+}
+
+/*
+elasticQueryFromNode compiles the parsed search box query.
+terms without field of a sequence or an OR are collected into one fulltext query, lang is the query language.
+the fulltext fields are boosted with r
+*/
+func elasticQueryFromNode(node QueryNode, lang string, r *Ranking) *tElasticFieldValue {
+	switch n := node.(type) {
+	case *QueryTermNode:
+		if n.Field == "" {
+			return elasticFulltextQuery(elasticTermText(n), lang, r)
+		}
+		return elasticFieldQuery(n, lang)
+	case *QueryRangeNode:
+		return elasticRangeFieldQuery(n)
+	case *QueryNotNode:
+		return elasticQuery().withBooleanQuery(elasticBooleanQuery(0).
+			withMust(elasticMatchAllQuery(1.0).FieldValue()).
+			withMustNot(elasticQueryFromNode(n.Child, lang, r))).FieldValue()
+	case *QueryBoolNode:
+		positives := []*tElasticFieldValue{}
+		negatives := []*tElasticFieldValue{}
+		texts := []string{}
+		for _, child := range n.Children {
+			if not, ok := child.(*QueryNotNode); ok {
+				negatives = append(negatives, elasticQueryFromNode(not.Child, lang, r))
+				continue
+			}
+			if term, ok := child.(*QueryTermNode); ok && term.Field == "" && n.Op != QueryOperatorAND {
+				texts = append(texts, elasticTermText(term))
+				continue
+			}
+			positives = append(positives, elasticQueryFromNode(child, lang, r))
+		}
+		if len(texts) > 0 {
+			positives = append(positives, elasticFulltextQuery(strings.Join(texts, " "), lang, r))
+		}
+		bq := elasticBooleanQuery(0)
+		switch {
+		case len(positives) == 0:
+			bq.withMust(elasticMatchAllQuery(1.0).FieldValue())
+		case n.Op == QueryOperatorAND:
+			bq.withMust(positives...)
+		default:
+			bq.withShould(1, positives...)
+		}
+		if len(negatives) > 0 {
+			bq.withMustNot(negatives...)
+		}
+		return elasticQuery().withBooleanQuery(bq).FieldValue()
+	}
+	return elasticMatchAllQuery(1.0).FieldValue()
+}
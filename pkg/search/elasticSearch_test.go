@@ -0,0 +1,112 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// an overloaded cluster answers the scroll with 429 and a body which is no json
+func TestElasticScrollUnavailable(t *testing.T) {
+	var lock sync.Mutex
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		switch {
+		case strings.HasSuffix(req.URL.Path, "/_pit") && req.Method == http.MethodPost:
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"id":"pit"}`)
+		case req.URL.Path == "/_pit":
+			io.WriteString(w, `{"succeeded":true}`)
+		default:
+			body, _ := io.ReadAll(req.Body)
+			lock.Lock()
+			query = string(body)
+			lock.Unlock()
+			w.WriteHeader(http.StatusTooManyRequests)
+			io.WriteString(w, "too many requests")
+		}
+	}))
+	defer srv.Close()
+
+	logger := zerolog.Nop()
+	mte, err := NewMTElasticSearch([]string{srv.URL}, "test", "", &logger)
+	if err != nil {
+		t.Fatalf("cannot create elastic client: %v", err)
+	}
+	err = mte.Scroll(context.Background(), &ScrollConfig{Groups: []string{"global/guest"}}, func(data *SourceData) error {
+		return nil
+	})
+	if !errors.Is(err, ErrUnavailable) {
+		t.Errorf("overloaded cluster not unavailable: %v", err)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if !strings.Contains(query, `"acl.meta.keyword"`) {
+		t.Errorf("scroll does not filter on acl.meta.keyword: %s", query)
+	}
+}
+
+// the hybrid search fuses the hits up to the result window of elastic and stops the cursor there
+func TestElasticHybridWindow(t *testing.T) {
+	var lock sync.Mutex
+	sizes := []int64{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		var fq struct {
+			Size int64 `json:"size"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&fq); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		lock.Lock()
+		sizes = append(sizes, fq.Size)
+		lock.Unlock()
+		hits := []string{}
+		for i := int64(0); i < fq.Size; i++ {
+			hits = append(hits, fmt.Sprintf(`{"_id":"d%d","_source":{"signature":"d%d"}}`, i, i))
+		}
+		fmt.Fprintf(w, `{"hits":{"total":{"value":20000},"hits":[%s]}}`, strings.Join(hits, ","))
+	}))
+	defer srv.Close()
+
+	logger := zerolog.Nop()
+	mte, err := NewMTElasticSearch([]string{srv.URL}, "test", "", &logger)
+	if err != nil {
+		t.Fatalf("cannot create elastic client: %v", err)
+	}
+	mte.SetEmbedder(NewFakeEmbedder(8))
+	cfg := &SearchConfig{QStr: "kunst", Mode: SearchModeHybrid, Start: elasticMaxResultWindow - 10, Rows: 20}
+	_, docs, total, _, next, err := mte.Search(cfg)
+	if err != nil {
+		t.Fatalf("cannot search: %v", err)
+	}
+	if len(docs) != 10 || next != "" {
+		t.Errorf("%d hits and cursor '%s' behind the window", len(docs), next)
+	}
+	if total != 20000 || !cfg.TotalEstimated() {
+		t.Errorf("unexpected total %d", total)
+	}
+	lock.Lock()
+	for _, size := range sizes {
+		if size != elasticMaxResultWindow {
+			t.Errorf("window of %d hits instead of %d", size, elasticMaxResultWindow)
+		}
+	}
+	lock.Unlock()
+
+	cfg = &SearchConfig{QStr: "kunst", Mode: SearchModeHybrid, Rows: 10, Sort: SortOrder{Field: SortTitle}}
+	if _, _, _, _, _, err := mte.Search(cfg); err == nil {
+		t.Errorf("hybrid search sorted by title")
+	}
+}
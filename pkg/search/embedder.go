@@ -0,0 +1,73 @@
+package search
+
+import (
+	"github.com/je4/utils/v2/pkg/openai"
+	"github.com/pkg/errors"
+	oai "github.com/sashabaranov/go-openai"
+	"hash/fnv"
+	"math"
+	"strings"
+)
+
+// EmbeddingDimensions is the vector size of title_vector and content_vector (openai text-embedding-3-small)
+const EmbeddingDimensions = 1536
+
+/*
+Embedder converts a query string into a vector comparable with SourceData.TitleVector and SourceData.ContentVector
+*/
+type Embedder interface {
+	Embed(text string) ([]float32, error)
+}
+
+type OpenAIEmbedder struct {
+	client *openai.ClientV2
+}
+
+// NewOpenAIEmbedder uses the same model as SourceData.CreateEmbedding
+func NewOpenAIEmbedder(client *openai.ClientV2) *OpenAIEmbedder {
+	return &OpenAIEmbedder{client: client}
+}
+
+func (oe *OpenAIEmbedder) Embed(text string) ([]float32, error) {
+	emb, err := oe.client.CreateEmbedding(text, oai.SmallEmbedding3)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot create embedding for '%s'", text)
+	}
+	return emb.Embedding, nil
+}
+
+/*
+FakeEmbedder is a deterministic local embedder for tests.
+every word is hashed into one dimension, so texts sharing words are similar
+*/
+type FakeEmbedder struct {
+	dims int
+}
+
+func NewFakeEmbedder(dims int) *FakeEmbedder {
+	if dims <= 0 {
+		dims = EmbeddingDimensions
+	}
+	return &FakeEmbedder{dims: dims}
+}
+
+func (fe *FakeEmbedder) Embed(text string) ([]float32, error) {
+	vec := make([]float32, fe.dims)
+	for _, word := range wordsRegexp.FindAllString(strings.ToLower(text), -1) {
+		h := fnv.New32a()
+		h.Write([]byte(word))
+		vec[h.Sum32()%uint32(fe.dims)] += 1
+	}
+	var norm float64
+	for _, v := range vec {
+		norm += float64(v * v)
+	}
+	if norm == 0 {
+		return vec, nil
+	}
+	norm = math.Sqrt(norm)
+	for i := range vec {
+		vec[i] = float32(float64(vec[i]) / norm)
+	}
+	return vec, nil
+}
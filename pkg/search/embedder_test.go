@@ -0,0 +1,65 @@
+package search
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func cosine(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+func TestFakeEmbedder(t *testing.T) {
+	fe := NewFakeEmbedder(64)
+	v1, err := fe.Embed("Kunst im öffentlichen Raum")
+	if err != nil {
+		t.Fatalf("cannot embed: %v", err)
+	}
+	v2, _ := fe.Embed("kunst im öffentlichen raum")
+	v3, _ := fe.Embed("Kunst und Raum")
+	v4, _ := fe.Embed("Architektur")
+	if len(v1) != 64 {
+		t.Errorf("unexpected dimensions %v", len(v1))
+	}
+	if c := cosine(v1, v2); c < 0.999 {
+		t.Errorf("embedding not deterministic: %v", c)
+	}
+	if cosine(v1, v3) <= cosine(v1, v4) {
+		t.Errorf("similar text not closer than unrelated text")
+	}
+}
+
+func TestElasticKnnQueries(t *testing.T) {
+	mte := &MTElasticSearch{}
+	if _, err := mte.knnQueries("kunst", nil, 10); err == nil {
+		t.Errorf("semantic search without embedder should fail")
+	}
+	mte.SetEmbedder(NewFakeEmbedder(8))
+	if !slices.Contains(mte.SearchModes(), SearchModeSemantic) {
+		t.Errorf("semantic mode not available: %v", mte.SearchModes())
+	}
+	filters := elasticSearchFilters(&SearchConfig{Groups: []string{"global/guest"}})
+	knn, err := mte.knnQueries("kunst", filters, 30)
+	if err != nil {
+		t.Fatalf("cannot create knn queries: %v", err)
+	}
+	fq := elasticSearch(nil, nil, nil, nil, 20, 10).withKnn(knn...)
+	jsonstr, err := json.Marshal(fq)
+	if err != nil {
+		t.Fatalf("cannot marshal query: %v", err)
+	}
+	for _, str := range []string{`"field":"title_vector"`, `"field":"content_vector"`, `"k":30`, `"acl.meta.keyword":["global/guest"]`} {
+		if !strings.Contains(string(jsonstr), str) {
+			t.Errorf("%s missing in %s", str, jsonstr)
+		}
+	}
+	if strings.Contains(string(jsonstr), `"query"`) {
+		t.Errorf("vector search must not contain a lexical query: %s", jsonstr)
+	}
+}
@@ -0,0 +1,148 @@
+package search
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// separator of the levels in hierarchical values like category
+const HierarchySeparator = "!!"
+
+// number of paths of a hierarchical facet if no limit is given
+const hierarchyFacetSize = 500
+
+/*
+FacetNode is a level of a hierarchical facet.
+Open is set for the ancestors of a selected node, their children are shown
+*/
+type FacetNode struct {
+	Id       string       `json:"id"`
+	ParentId string       `json:"parentid,omitempty"`
+	Name     string       `json:"name"`
+	Path     string       `json:"path"`
+	Count    int          `json:"count"`
+	Selected bool         `json:"selected"`
+	Open     bool         `json:"open"`
+	Children []*FacetNode `json:"children,omitempty"`
+}
+
+// hierarchyParent returns the parent path or "" for the top level
+func hierarchyParent(path string) string {
+	pos := strings.LastIndex(path, HierarchySeparator)
+	if pos < 0 {
+		return ""
+	}
+	return path[:pos]
+}
+
+// hierarchyOpen returns the paths whose children are visible: the selected paths and their ancestors
+func hierarchyOpen(selected map[string]bool) map[string]bool {
+	open := map[string]bool{}
+	for path, sel := range selected {
+		if !sel {
+			continue
+		}
+		for p := path; p != ""; p = hierarchyParent(p) {
+			open[p] = true
+		}
+	}
+	return open
+}
+
+// hierarchyVisible is true for the top level and the children of open paths
+func hierarchyVisible(path string, open map[string]bool) bool {
+	parent := hierarchyParent(path)
+	return parent == "" || open[parent]
+}
+
+/*
+hierarchyNormalizeSelection keeps only the deepest selected paths.
+selecting a child of a selected node drills down instead of widening the filter
+*/
+func hierarchyNormalizeSelection(selected map[string]bool) {
+	for path, sel := range selected {
+		if !sel {
+			continue
+		}
+		for p := hierarchyParent(path); p != ""; p = hierarchyParent(p) {
+			delete(selected, p)
+		}
+	}
+}
+
+var luceneRegexpSpecial = regexp.MustCompile(`[.?+*|{}\[\]()"\\#@&<>~]`)
+
+// elasticHierarchyInclude creates the regexp of the visible paths for the include of a terms aggregation
+func elasticHierarchyInclude(selected map[string]bool) string {
+	level := `[^!]+(![^!]+)*`
+	alternatives := []string{level}
+	open := hierarchyOpen(selected)
+	paths := []string{}
+	for path := range open {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		alternatives = append(alternatives, luceneRegexpSpecial.ReplaceAllString(path, `\$0`)+HierarchySeparator+level)
+	}
+	return strings.Join(alternatives, "|")
+}
+
+/*
+FacetTree builds the tree of a hierarchical facet from the counts of all paths.
+only the top level and the children of selected nodes and their ancestors are part of the tree
+*/
+func FacetTree(facet string, counts map[string]int, selected map[string]bool) []*FacetNode {
+	open := hierarchyOpen(selected)
+	nodes := map[string]*FacetNode{}
+	paths := []string{}
+	for path := range counts {
+		if path == "" || path[0] == '\u0001' || !hierarchyVisible(path, open) {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	// ancestors of selected paths are needed even without count
+	for path := range open {
+		if _, ok := counts[path]; !ok && hierarchyVisible(path, open) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		node := &FacetNode{
+			Id:       FacetNodeId(facet, path),
+			Name:     path,
+			Path:     path,
+			Count:    counts[path],
+			Selected: selected[path],
+			Open:     open[path],
+		}
+		if parent := hierarchyParent(path); parent != "" {
+			node.Name = path[len(parent)+len(HierarchySeparator):]
+			node.ParentId = FacetNodeId(facet, parent)
+		}
+		nodes[path] = node
+	}
+	tree := []*FacetNode{}
+	for _, path := range paths {
+		node := nodes[path]
+		parent, ok := nodes[hierarchyParent(path)]
+		if !ok {
+			tree = append(tree, node)
+			continue
+		}
+		parent.Children = append(parent.Children, node)
+	}
+	return tree
+}
+
+// FacetNodeId creates the form field name of a node, the path is hashed because of the characters in category names
+func FacetNodeId(facet, path string) string {
+	h := fnv.New32a()
+	h.Write([]byte(path))
+	return fmt.Sprintf("facet_%s_%x", facet, h.Sum32())
+}
@@ -0,0 +1,38 @@
+package search
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestFacetTree(t *testing.T) {
+	counts := map[string]int{"a": 5, "a!!b": 3, "a!!b!!c": 1, "a!!d": 2, "e": 1, "e!!f": 1}
+	selected := map[string]bool{"a": true, "a!!b": true}
+	hierarchyNormalizeSelection(selected)
+	if selected["a"] || !selected["a!!b"] {
+		t.Fatalf("only the deepest selection should remain: %v", selected)
+	}
+
+	tree := FacetTree("category", counts, selected)
+	if len(tree) != 2 || tree[0].Path != "a" || tree[1].Path != "e" {
+		t.Fatalf("unexpected top level %v", tree)
+	}
+	a := tree[0]
+	if !a.Open || len(a.Children) != 2 || a.Children[0].Name != "b" || a.Children[0].Count != 3 {
+		t.Errorf("unexpected children of a: %+v", a.Children)
+	}
+	b := a.Children[0]
+	if !b.Selected || b.ParentId != a.Id || len(b.Children) != 1 || b.Children[0].Name != "c" {
+		t.Errorf("unexpected node b: %+v", b)
+	}
+	if len(tree[1].Children) != 0 {
+		t.Errorf("children of closed node e are visible: %+v", tree[1].Children)
+	}
+
+	include := regexp.MustCompile(`^(` + elasticHierarchyInclude(selected) + `)$`)
+	for path, visible := range map[string]bool{"a": true, "a!!b": true, "a!!b!!c": true, "a!!d": true, "e!!f": false, "a!!d!!g": false} {
+		if include.MatchString(path) != visible {
+			t.Errorf("include of %s should be %v", path, visible)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package search
+
+import (
+	"fmt"
+	"github.com/je4/zsearch/v2/pkg/translate"
+	"slices"
+)
+
+// factors of the field boost for matches in the native or machine translated text of the query language
+const (
+	langNativeBoost     = 1.5
+	langTranslatedBoost = 1.0
+)
+
+/*
+LangText is a MultiLangString split into the sort languages, which are indexed with their stemmers.
+native and machine translated texts are kept apart, so native matches can be boosted
+*/
+type LangText struct {
+	Native     map[string]string `json:"native,omitempty"`
+	Translated map[string]string `json:"translated,omitempty"`
+}
+
+// newLangText returns nil if mls has no text in any of the sort languages
+func newLangText(mls *translate.MultiLangString) *LangText {
+	if mls == nil || len(*mls) == 0 {
+		return nil
+	}
+	lt := &LangText{Native: map[string]string{}, Translated: map[string]string{}}
+	native := mls.GetNativeLanguages()
+	for _, lang := range SortLanguages {
+		str := mls.Get(lang)
+		if str == "" {
+			continue
+		}
+		base, _ := lang.Base()
+		if slices.Contains(native, lang) {
+			lt.Native[base.String()] = str
+		} else {
+			lt.Translated[base.String()] = str
+		}
+	}
+	if len(lt.Native) == 0 && len(lt.Translated) == 0 {
+		return nil
+	}
+	return lt
+}
+
+type langField struct {
+	Field string
+	Boost float64
+}
+
+/*
+langFieldBoosts returns the language fields of a text field with their boosts.
+without lang the text is not searched language aware, unknown languages use the default sort language
+*/
+func langFieldBoosts(field string, boost float64, lang string) []langField {
+	if lang == "" {
+		return nil
+	}
+	lang = sortLanguage(lang)
+	return []langField{
+		{Field: fmt.Sprintf("%slang.native.%s", field, lang), Boost: boost * langNativeBoost},
+		{Field: fmt.Sprintf("%slang.translated.%s", field, lang), Boost: boost * langTranslatedBoost},
+	}
+}
+
+// langFields returns the language fields in the syntax of elastic (e.g. "titlelang.native.de^6")
+func langFields(field string, boost float64, lang string) []string {
+	result := []string{}
+	for _, lf := range langFieldBoosts(field, boost, lang) {
+		result = append(result, fmt.Sprintf("%s^%v", lf.Field, lf.Boost))
+	}
+	return result
+}
@@ -0,0 +1,132 @@
+package search
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+type lruEntry struct {
+	src       *SourceData
+	timestamp time.Time
+}
+
+/*
+LRUCache keeps up to size documents in memory.
+the least recently used document is evicted if the cache is full
+*/
+type LRUCache struct {
+	sync.Mutex
+	size     int
+	expiry   time.Duration
+	list     *list.List
+	items    map[string]*list.Element
+	counters cacheCounters
+}
+
+func NewLRUCache(size int, expiry time.Duration) *LRUCache {
+	return &LRUCache{
+		size:   size,
+		expiry: expiry,
+		list:   list.New(),
+		items:  map[string]*list.Element{},
+	}
+}
+
+func (lc *LRUCache) expired(entry *lruEntry, now time.Time) bool {
+	return lc.expiry > 0 && now.After(entry.timestamp.Add(lc.expiry))
+}
+
+func (lc *LRUCache) remove(elem *list.Element) {
+	lc.list.Remove(elem)
+	delete(lc.items, elem.Value.(*lruEntry).src.Signature)
+}
+
+func (lc *LRUCache) Get(signature string) (*SourceData, time.Time, error) {
+	lc.Lock()
+	defer lc.Unlock()
+	elem, ok := lc.items[signature]
+	if !ok {
+		lc.counters.misses.Add(1)
+		return nil, time.Time{}, ErrCacheMiss
+	}
+	entry := elem.Value.(*lruEntry)
+	if lc.expired(entry, time.Now()) {
+		lc.remove(elem)
+		lc.counters.expired.Add(1)
+		lc.counters.misses.Add(1)
+		return nil, time.Time{}, ErrCacheMiss
+	}
+	lc.list.MoveToFront(elem)
+	lc.counters.hits.Add(1)
+	// every caller gets its own document like with badger
+	return entry.src.Copy(), entry.timestamp, nil
+}
+
+func (lc *LRUCache) Set(src *SourceData) error {
+	lc.Lock()
+	defer lc.Unlock()
+	entry := &lruEntry{src: src.Copy(), timestamp: time.Now()}
+	if elem, ok := lc.items[src.Signature]; ok {
+		elem.Value = entry
+		lc.list.MoveToFront(elem)
+		return nil
+	}
+	lc.items[src.Signature] = lc.list.PushFront(entry)
+	for lc.list.Len() > lc.size {
+		lc.remove(lc.list.Back())
+		lc.counters.evictions.Add(1)
+	}
+	return nil
+}
+
+func (lc *LRUCache) Delete(signatures ...string) error {
+	lc.Lock()
+	defer lc.Unlock()
+	for _, signature := range signatures {
+		if elem, ok := lc.items[signature]; ok {
+			lc.remove(elem)
+		}
+	}
+	return nil
+}
+
+func (lc *LRUCache) DeletePrefix(prefix string) error {
+	lc.Lock()
+	defer lc.Unlock()
+	for signature, elem := range lc.items {
+		if strings.HasPrefix(signature, prefix) {
+			lc.remove(elem)
+		}
+	}
+	return nil
+}
+
+func (lc *LRUCache) Clear() error {
+	lc.Lock()
+	defer lc.Unlock()
+	lc.list.Init()
+	lc.items = map[string]*list.Element{}
+	return nil
+}
+
+func (lc *LRUCache) Sweep() error {
+	lc.Lock()
+	defer lc.Unlock()
+	now := time.Now()
+	for _, elem := range lc.items {
+		if lc.expired(elem.Value.(*lruEntry), now) {
+			lc.remove(elem)
+			lc.counters.expired.Add(1)
+		}
+	}
+	return nil
+}
+
+func (lc *LRUCache) Stats() CacheStats {
+	lc.Lock()
+	entries := int64(lc.list.Len())
+	lc.Unlock()
+	return lc.counters.stats(CacheBackendLRU, entries)
+}
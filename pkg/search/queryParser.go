@@ -0,0 +1,501 @@
+package search
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+/*
+query language of the search box
+
+	kunst raum                  words, combined with OR
+	"kunst im raum"             phrase
+	author:meier                field prefix, the field names come from [searchfields]
+	author:"meier, hans"        field with phrase
+	kunst AND (raum OR zeit)    boolean operators (AND, OR, NOT, &&, ||, !) and parentheses
+	-raum                       same as NOT raum
+	kun* / k?nst                wildcards
+	date:[1990 TO 2000]         inclusive range, {1990 TO 2000} is exclusive
+*/
+
+type QuerySyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (qse *QuerySyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at position %d: %s", qse.Pos+1, qse.Msg)
+}
+
+type QueryOperator string
+
+const (
+	QueryOperatorDefault QueryOperator = ""
+	QueryOperatorAND     QueryOperator = "AND"
+	QueryOperatorOR      QueryOperator = "OR"
+)
+
+type QueryNode interface {
+	String() string
+}
+
+// QueryBoolNode combines its children. QueryOperatorDefault is a plain sequence of terms
+type QueryBoolNode struct {
+	Op       QueryOperator
+	Children []QueryNode
+}
+
+type QueryNotNode struct {
+	Child QueryNode
+}
+
+// QueryTermNode is a word or a phrase, Field is empty for a search in all fields
+type QueryTermNode struct {
+	Field    string
+	Value    string
+	Phrase   bool
+	Wildcard bool
+}
+
+type QueryRangeNode struct {
+	Field        string
+	From         string
+	To           string
+	IncludeLower bool
+	IncludeUpper bool
+}
+
+func quoteQueryValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " \t\"():[]{}") || isQueryKeyword(value) {
+		return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+	}
+	return value
+}
+
+func (qn *QueryBoolNode) String() string {
+	parts := []string{}
+	for _, child := range qn.Children {
+		str := child.String()
+		if cb, ok := child.(*QueryBoolNode); ok && len(cb.Children) > 1 {
+			str = "(" + str + ")"
+		}
+		parts = append(parts, str)
+	}
+	sep := " "
+	if qn.Op != QueryOperatorDefault {
+		sep = " " + string(qn.Op) + " "
+	}
+	return strings.Join(parts, sep)
+}
+
+func (qn *QueryNotNode) String() string {
+	str := qn.Child.String()
+	if cb, ok := qn.Child.(*QueryBoolNode); ok && len(cb.Children) > 1 {
+		str = "(" + str + ")"
+	}
+	return "NOT " + str
+}
+
+func (qn *QueryTermNode) String() string {
+	value := qn.Value
+	if qn.Phrase {
+		value = `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+	} else if !qn.Wildcard {
+		value = quoteQueryValue(value)
+	}
+	if qn.Field == "" {
+		return value
+	}
+	return qn.Field + ":" + value
+}
+
+func (qn *QueryRangeNode) String() string {
+	open, close := "{", "}"
+	if qn.IncludeLower {
+		open = "["
+	}
+	if qn.IncludeUpper {
+		close = "]"
+	}
+	return fmt.Sprintf("%s:%s%s TO %s%s", qn.Field, open, quoteQueryValue(qn.From), quoteQueryValue(qn.To), close)
+}
+
+type queryTokenType int
+
+const (
+	queryTokenEOF queryTokenType = iota
+	queryTokenWord
+	queryTokenPhrase
+	queryTokenField
+	queryTokenAND
+	queryTokenOR
+	queryTokenNOT
+	queryTokenTO
+	queryTokenLParen
+	queryTokenRParen
+	queryTokenLRange
+	queryTokenRRange
+)
+
+type queryToken struct {
+	typ   queryTokenType
+	value string
+	pos   int
+}
+
+func isQueryKeyword(str string) bool {
+	switch str {
+	case "AND", "OR", "NOT", "TO":
+		return true
+	}
+	return false
+}
+
+func isQuerySpecial(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune(`()[]{}":`, r)
+}
+
+func lexQuery(str string) ([]queryToken, error) {
+	runes := []rune(str)
+	tokens := []queryToken{}
+	for pos := 0; pos < len(runes); {
+		r := runes[pos]
+		switch {
+		case unicode.IsSpace(r):
+			pos++
+		case r == '(':
+			tokens = append(tokens, queryToken{typ: queryTokenLParen, value: "(", pos: pos})
+			pos++
+		case r == ')':
+			tokens = append(tokens, queryToken{typ: queryTokenRParen, value: ")", pos: pos})
+			pos++
+		case r == '[' || r == '{':
+			tokens = append(tokens, queryToken{typ: queryTokenLRange, value: string(r), pos: pos})
+			pos++
+		case r == ']' || r == '}':
+			tokens = append(tokens, queryToken{typ: queryTokenRRange, value: string(r), pos: pos})
+			pos++
+		case r == ':':
+			// a colon without a field name is ignored (e.g. "Kunst : Raum")
+			pos++
+		case r == '"':
+			start := pos
+			pos++
+			var sb strings.Builder
+			closed := false
+			for pos < len(runes) {
+				if runes[pos] == '\\' && pos+1 < len(runes) && runes[pos+1] == '"' {
+					sb.WriteRune('"')
+					pos += 2
+					continue
+				}
+				if runes[pos] == '"' {
+					closed = true
+					pos++
+					break
+				}
+				sb.WriteRune(runes[pos])
+				pos++
+			}
+			if !closed {
+				return nil, &QuerySyntaxError{Pos: start, Msg: "missing closing quote"}
+			}
+			tokens = append(tokens, queryToken{typ: queryTokenPhrase, value: sb.String(), pos: start})
+		case (r == '-' || r == '!') && pos+1 < len(runes) && !unicode.IsSpace(runes[pos+1]):
+			tokens = append(tokens, queryToken{typ: queryTokenNOT, value: string(r), pos: pos})
+			pos++
+		default:
+			start := pos
+			for pos < len(runes) && !isQuerySpecial(runes[pos]) {
+				pos++
+			}
+			word := string(runes[start:pos])
+			// field prefix needs a value directly after the colon
+			if pos+1 < len(runes) && runes[pos] == ':' && !unicode.IsSpace(runes[pos+1]) {
+				tokens = append(tokens, queryToken{typ: queryTokenField, value: word, pos: start})
+				pos++
+				continue
+			}
+			switch word {
+			case "AND", "&&":
+				tokens = append(tokens, queryToken{typ: queryTokenAND, value: word, pos: start})
+			case "OR", "||":
+				tokens = append(tokens, queryToken{typ: queryTokenOR, value: word, pos: start})
+			case "NOT":
+				tokens = append(tokens, queryToken{typ: queryTokenNOT, value: word, pos: start})
+			case "TO":
+				tokens = append(tokens, queryToken{typ: queryTokenTO, value: word, pos: start})
+			default:
+				tokens = append(tokens, queryToken{typ: queryTokenWord, value: word, pos: start})
+			}
+		}
+	}
+	tokens = append(tokens, queryToken{typ: queryTokenEOF, pos: len(runes)})
+	return tokens, nil
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+	fields map[string]string
+}
+
+/*
+ParseQuery parses the search box syntax.
+fields maps the field names of the query to the index fields, unknown field prefixes are treated as text.
+with fields == nil every field prefix is used as index field. an empty query returns nil
+*/
+func ParseQuery(str string, fields map[string]string) (QueryNode, error) {
+	tokens, err := lexQuery(str)
+	if err != nil {
+		return nil, err
+	}
+	qp := &queryParser{tokens: tokens, fields: fields}
+	if qp.peek().typ == queryTokenEOF {
+		return nil, nil
+	}
+	node, err := qp.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := qp.peek(); tok.typ != queryTokenEOF {
+		if tok.typ == queryTokenRParen {
+			return nil, &QuerySyntaxError{Pos: tok.pos, Msg: "unexpected ')' without matching '('"}
+		}
+		return nil, &QuerySyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("unexpected '%s'", tok.value)}
+	}
+	return node, nil
+}
+
+func (qp *queryParser) peek() queryToken {
+	return qp.tokens[qp.pos]
+}
+
+func (qp *queryParser) next() queryToken {
+	tok := qp.tokens[qp.pos]
+	if tok.typ != queryTokenEOF {
+		qp.pos++
+	}
+	return tok
+}
+
+func (qp *queryParser) parseOr() (QueryNode, error) {
+	node, err := qp.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	children := []QueryNode{node}
+	for qp.peek().typ == queryTokenOR {
+		qp.next()
+		node, err := qp.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, node)
+	}
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return &QueryBoolNode{Op: QueryOperatorOR, Children: children}, nil
+}
+
+func (qp *queryParser) parseAnd() (QueryNode, error) {
+	node, err := qp.parseSequence()
+	if err != nil {
+		return nil, err
+	}
+	children := []QueryNode{node}
+	for qp.peek().typ == queryTokenAND {
+		qp.next()
+		node, err := qp.parseSequence()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, node)
+	}
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return &QueryBoolNode{Op: QueryOperatorAND, Children: children}, nil
+}
+
+// terms without operator
+func (qp *queryParser) parseSequence() (QueryNode, error) {
+	node, err := qp.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	children := []QueryNode{node}
+	for {
+		switch qp.peek().typ {
+		case queryTokenWord, queryTokenPhrase, queryTokenField, queryTokenNOT, queryTokenLParen:
+			node, err := qp.parseNot()
+			if err != nil {
+				return nil, err
+			}
+			children = append(children, node)
+			continue
+		}
+		break
+	}
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return &QueryBoolNode{Op: QueryOperatorDefault, Children: children}, nil
+}
+
+func (qp *queryParser) parseNot() (QueryNode, error) {
+	if qp.peek().typ == queryTokenNOT {
+		tok := qp.next()
+		if qp.peek().typ == queryTokenEOF {
+			return nil, &QuerySyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("'%s' without search term", tok.value)}
+		}
+		child, err := qp.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &QueryNotNode{Child: child}, nil
+	}
+	return qp.parsePrimary()
+}
+
+func (qp *queryParser) parsePrimary() (QueryNode, error) {
+	tok := qp.next()
+	switch tok.typ {
+	case queryTokenLParen:
+		if qp.peek().typ == queryTokenRParen {
+			return nil, &QuerySyntaxError{Pos: tok.pos, Msg: "empty parentheses"}
+		}
+		node, err := qp.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if qp.peek().typ != queryTokenRParen {
+			return nil, &QuerySyntaxError{Pos: tok.pos, Msg: "missing closing ')'"}
+		}
+		qp.next()
+		return node, nil
+	case queryTokenWord:
+		return &QueryTermNode{Value: tok.value, Wildcard: strings.ContainsAny(tok.value, "*?")}, nil
+	case queryTokenPhrase:
+		return &QueryTermNode{Value: tok.value, Phrase: true}, nil
+	case queryTokenField:
+		return qp.parseField(tok)
+	case queryTokenEOF:
+		return nil, &QuerySyntaxError{Pos: tok.pos, Msg: "unexpected end of query"}
+	case queryTokenRParen:
+		return nil, &QuerySyntaxError{Pos: tok.pos, Msg: "unexpected ')' without matching '('"}
+	case queryTokenTO, queryTokenLRange, queryTokenRRange:
+		return nil, &QuerySyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("'%s' only allowed in a field range like date:[1990 TO 2000]", tok.value)}
+	default:
+		return nil, &QuerySyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("missing search term before '%s'", tok.value)}
+	}
+}
+
+func (qp *queryParser) parseField(fieldTok queryToken) (QueryNode, error) {
+	field, ok := qp.fields[fieldTok.value]
+	if qp.fields == nil {
+		field, ok = fieldTok.value, true
+	}
+	if !ok {
+		// not a field, keep "name:value" as text
+		tok := qp.peek()
+		if tok.typ == queryTokenWord {
+			qp.next()
+			value := fieldTok.value + ":" + tok.value
+			return &QueryTermNode{Value: value, Wildcard: strings.ContainsAny(value, "*?")}, nil
+		}
+		return nil, &QuerySyntaxError{Pos: fieldTok.pos, Msg: fmt.Sprintf("unknown field '%s' (known fields: %s)", fieldTok.value, strings.Join(queryFieldNames(qp.fields), ", "))}
+	}
+	tok := qp.next()
+	switch tok.typ {
+	case queryTokenWord:
+		return &QueryTermNode{Field: field, Value: tok.value, Wildcard: strings.ContainsAny(tok.value, "*?")}, nil
+	case queryTokenPhrase:
+		return &QueryTermNode{Field: field, Value: tok.value, Phrase: true}, nil
+	case queryTokenLParen:
+		// author:(meier OR müller) is the same as (author:meier OR author:müller)
+		qp.pos--
+		node, err := qp.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		applyQueryField(node, field)
+		return node, nil
+	case queryTokenLRange:
+		from := qp.next()
+		if from.typ != queryTokenWord && from.typ != queryTokenPhrase {
+			return nil, &QuerySyntaxError{Pos: from.pos, Msg: fmt.Sprintf("missing lower bound in range of field '%s'", fieldTok.value)}
+		}
+		if to := qp.next(); to.typ != queryTokenTO {
+			return nil, &QuerySyntaxError{Pos: to.pos, Msg: fmt.Sprintf("missing 'TO' in range of field '%s'", fieldTok.value)}
+		}
+		to := qp.next()
+		if to.typ != queryTokenWord && to.typ != queryTokenPhrase {
+			return nil, &QuerySyntaxError{Pos: to.pos, Msg: fmt.Sprintf("missing upper bound in range of field '%s'", fieldTok.value)}
+		}
+		end := qp.next()
+		if end.typ != queryTokenRRange {
+			return nil, &QuerySyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("missing closing ']' in range of field '%s'", fieldTok.value)}
+		}
+		return &QueryRangeNode{
+			Field:        field,
+			From:         from.value,
+			To:           to.value,
+			IncludeLower: tok.value == "[",
+			IncludeUpper: end.value == "]",
+		}, nil
+	default:
+		return nil, &QuerySyntaxError{Pos: fieldTok.pos, Msg: fmt.Sprintf("missing value for field '%s'", fieldTok.value)}
+	}
+}
+
+func queryFieldNames(fields map[string]string) []string {
+	names := []string{}
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func applyQueryField(node QueryNode, field string) {
+	switch n := node.(type) {
+	case *QueryBoolNode:
+		for _, child := range n.Children {
+			applyQueryField(child, field)
+		}
+	case *QueryNotNode:
+		applyQueryField(n.Child, field)
+	case *QueryTermNode:
+		if n.Field == "" {
+			n.Field = field
+		}
+	}
+}
+
+// QueryWords returns the text of all positive terms, e.g. for embeddings
+func QueryWords(node QueryNode) []string {
+	switch n := node.(type) {
+	case *QueryBoolNode:
+		words := []string{}
+		for _, child := range n.Children {
+			words = append(words, QueryWords(child)...)
+		}
+		return words
+	case *QueryTermNode:
+		return []string{strings.Trim(n.Value, "*?")}
+	}
+	return []string{}
+}
+
+// queryText removes the query syntax from qstr
+func queryText(qstr string) string {
+	node, err := ParseQuery(qstr, nil)
+	if err != nil || node == nil {
+		return qstr
+	}
+	return strings.Join(QueryWords(node), " ")
+}
@@ -0,0 +1,100 @@
+package search
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	fields := map[string]string{"author": "persons.name", "date": "date", "title": "title"}
+	tests := map[string]string{
+		`kunst raum`:                      `kunst raum`,
+		`"kunst im raum"`:                 `"kunst im raum"`,
+		`author:meier`:                    `persons.name:meier`,
+		`author:"meier, hans" kunst`:      `persons.name:"meier, hans" kunst`,
+		`kunst AND (raum OR zeit)`:        `kunst AND (raum OR zeit)`,
+		`kunst -raum`:                     `kunst NOT raum`,
+		`kun* && !k?nst`:                  `kun* AND NOT k?nst`,
+		`date:[1990 TO 2000]`:             `date:[1990 TO 2000]`,
+		`date:{1990 TO *]`:                `date:{1990 TO *]`,
+		`author:(meier OR müller)`:        `persons.name:meier OR persons.name:müller`,
+		`http://www.fhnw.ch`:              `"http://www.fhnw.ch"`,
+		`a OR b AND c`:                    `a OR (b AND c)`,
+		`title:kunst NOT (a b) date:1990`: `title:kunst NOT (a b) date:1990`,
+	}
+	for qstr, expected := range tests {
+		node, err := ParseQuery(qstr, fields)
+		if err != nil {
+			t.Errorf("cannot parse '%s': %v", qstr, err)
+			continue
+		}
+		if node.String() != expected {
+			t.Errorf("'%s': got '%s', expected '%s'", qstr, node.String(), expected)
+		}
+	}
+
+	if node, err := ParseQuery("  ", fields); node != nil || err != nil {
+		t.Errorf("empty query should return nil: %v, %v", node, err)
+	}
+
+	for qstr, pos := range map[string]int{
+		`kunst AND`:          10,
+		`(kunst raum`:        1,
+		`kunst)`:             6,
+		`"kunst`:             1,
+		`date:[1990 2000]`:   12,
+		`foo:"bar"`:          1,
+		`kunst OR OR raum`:   10,
+		`date:[1990 TO 2000`: 6,
+	} {
+		_, err := ParseQuery(qstr, fields)
+		var qse *QuerySyntaxError
+		if !errors.As(err, &qse) {
+			t.Errorf("'%s': expected syntax error, got %v", qstr, err)
+			continue
+		}
+		if qse.Pos+1 != pos {
+			t.Errorf("'%s': error at position %d, expected %d (%v)", qstr, qse.Pos+1, pos, err)
+		}
+	}
+}
+
+func TestElasticQueryFromNode(t *testing.T) {
+	node, err := ParseQuery(`kunst persons.name:meier -raum date:[1990 TO 1999]`, nil)
+	if err != nil {
+		t.Fatalf("cannot parse query: %v", err)
+	}
+	jsonstr, err := json.Marshal(elasticQueryFromNode(node, "de", DefaultRanking()))
+	if err != nil {
+		t.Fatalf("cannot marshal query: %v", err)
+	}
+	for _, str := range []string{`"query":"kunst*"`, `"path":"persons"`, `"must_not"`, `"itemdate":{"gte":"1990-01-01","lt":"2000-01-01"}`, `"titlelang.native.de^6"`} {
+		if !strings.Contains(string(jsonstr), str) {
+			t.Errorf("%s missing in %s", str, jsonstr)
+		}
+	}
+}
+
+func TestElasticDateRange(t *testing.T) {
+	for query, expected := range map[string]string{
+		`date:[1990 TO 1990]`:    `{"itemdate":{"gte":"1990-01-01","lt":"1991-01-01"}}`,
+		`date:{1990 TO 2000}`:    `{"itemdate":{"gte":"1991-01-01","lt":"2000-01-01"}}`,
+		`date:[1990-05 TO *]`:    `{"itemdate":{"gte":"1990-05-01"}}`,
+		`date:[* TO 2003-05-01]`: `{"itemdate":{"lt":"2003-05-02"}}`,
+		`date:[now-10y TO now]`:  `{"itemdate":{"gte":"now-10y","lt":"now"}}`,
+	} {
+		node, err := ParseQuery(query, nil)
+		if err != nil {
+			t.Fatalf("cannot parse %s: %v", query, err)
+		}
+		jsonstr, err := json.Marshal(elasticQueryFromNode(node, "", DefaultRanking()))
+		if err != nil {
+			t.Fatalf("cannot marshal query: %v", err)
+		}
+		if !strings.Contains(string(jsonstr), expected) {
+			t.Errorf("%s: %s missing in %s", query, expected, jsonstr)
+		}
+	}
+}
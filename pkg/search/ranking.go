@@ -0,0 +1,107 @@
+package search
+
+import (
+	"github.com/pkg/errors"
+	"time"
+)
+
+// boosts of the searched fields if not configured
+var defaultFieldBoosts = map[string]float64{
+	"title":              4,
+	"abstract":           3,
+	"notes":              3,
+	"persons.name":       5,
+	"media.pdf.fulltext": 1,
+}
+
+/*
+Ranking are the weights of the relevance search.
+the functions are compiled into a function_score query which multiplies the score of the matching documents
+*/
+type Ranking struct {
+	// boosts of title, abstract, notes, persons.name and media.pdf.fulltext
+	Fields map[string]float64 `toml:"fields"`
+	// factor for documents without media, 0.5 if not set, 1 disables
+	NoMedia *float64 `toml:"nomedia"`
+	// newer documents rank higher
+	Recency RecencyDecay `toml:"recency"`
+	// factors for documents of a catalog or with a media type
+	Catalog   map[string]float64 `toml:"catalog"`
+	Mediatype map[string]float64 `toml:"mediatype"`
+}
+
+/*
+RecencyDecay is a gauss decay on dateadded: documents older than offset + scale get the factor decay.
+it is disabled without scale
+*/
+type RecencyDecay struct {
+	Scale  string  `toml:"scale"`
+	Offset string  `toml:"offset"`
+	Decay  float64 `toml:"decay"`
+}
+
+// DefaultRanking are the weights used before the ranking was configurable
+func DefaultRanking() *Ranking {
+	noMedia := 0.5
+	return &Ranking{NoMedia: &noMedia}
+}
+
+// Check validates the configured values, durations use the elastic syntax (e.g. "30d")
+func (r *Ranking) Check() error {
+	for field, boost := range r.Fields {
+		if _, ok := defaultFieldBoosts[field]; !ok {
+			return errors.Errorf("unknown ranking field %s", field)
+		}
+		if boost < 0 {
+			return errors.Errorf("negative boost %v for field %s", boost, field)
+		}
+	}
+	if r.NoMedia != nil && *r.NoMedia < 0 {
+		return errors.Errorf("negative factor %v for documents without media", *r.NoMedia)
+	}
+	if r.Recency.Scale != "" {
+		if _, err := parseElasticDuration(r.Recency.Scale); err != nil {
+			return errors.Wrapf(err, "invalid recency scale")
+		}
+		if r.Recency.Offset != "" {
+			if _, err := parseElasticDuration(r.Recency.Offset); err != nil {
+				return errors.Wrapf(err, "invalid recency offset")
+			}
+		}
+		if r.Recency.Decay <= 0 || r.Recency.Decay >= 1 {
+			return errors.Errorf("recency decay %v not between 0 and 1", r.Recency.Decay)
+		}
+	}
+	for name, factors := range map[string]map[string]float64{"catalog": r.Catalog, "mediatype": r.Mediatype} {
+		for val, factor := range factors {
+			if factor < 0 {
+				return errors.Errorf("negative factor %v for %s %s", factor, name, val)
+			}
+		}
+	}
+	return nil
+}
+
+// boost returns the configured or the default boost of a field
+func (r *Ranking) boost(field string) float64 {
+	if boost, ok := r.Fields[field]; ok {
+		return boost
+	}
+	return defaultFieldBoosts[field]
+}
+
+func (r *Ranking) noMedia() float64 {
+	if r.NoMedia == nil {
+		return 0.5
+	}
+	return *r.NoMedia
+}
+
+// parseElasticDuration parses the time units of elastic which are needed for a decay (d, h, m, s)
+func parseElasticDuration(str string) (time.Duration, error) {
+	if len(str) > 1 && str[len(str)-1] == 'd' {
+		d, err := time.ParseDuration(str[:len(str)-1] + "h")
+		return d * 24, err
+	}
+	return time.ParseDuration(str)
+}
@@ -0,0 +1,65 @@
+package search
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestElasticRankingQuery(t *testing.T) {
+	r := &Ranking{
+		Fields:    map[string]float64{"title": 8},
+		Recency:   RecencyDecay{Scale: "365d", Offset: "30d", Decay: 0.5},
+		Catalog:   map[string]float64{"mediathek": 1.2},
+		Mediatype: map[string]float64{"video": 1.1},
+	}
+	if err := r.Check(); err != nil {
+		t.Fatalf("valid ranking rejected: %v", err)
+	}
+	node, err := ParseQuery("kunst", nil)
+	if err != nil {
+		t.Fatalf("cannot parse query: %v", err)
+	}
+	jsonstr, err := json.Marshal(elasticRankingQuery(elasticQueryFromNode(node, "", r), r))
+	if err != nil {
+		t.Fatalf("cannot marshal query: %v", err)
+	}
+	for _, str := range []string{
+		`"title^8"`, `"abstract^3"`,
+		`{"filter":{"term":{"hasmedia":{"value":false}}},"weight":0.5}`,
+		`"gauss":{"dateadded":{"decay":0.5,"offset":"30d","scale":"365d"}}`,
+		`{"filter":{"term":{"catalog":{"value":"mediathek"}}},"weight":1.2}`,
+		`{"filter":{"term":{"mediatype":{"value":"video"}}},"weight":1.1}`,
+	} {
+		if !strings.Contains(string(jsonstr), str) {
+			t.Errorf("%s missing in %s", str, jsonstr)
+		}
+	}
+
+	// documents without media can get the factor 0
+	noMedia := 0.0
+	r.NoMedia = &noMedia
+	if err := r.Check(); err != nil {
+		t.Fatalf("valid ranking rejected: %v", err)
+	}
+	jsonstr, err = json.Marshal(elasticRankingQuery(elasticQueryFromNode(node, "", r), r))
+	if err != nil {
+		t.Fatalf("cannot marshal query: %v", err)
+	}
+	if str := `{"filter":{"term":{"hasmedia":{"value":false}}},"weight":0}`; !strings.Contains(string(jsonstr), str) {
+		t.Errorf("%s missing in %s", str, jsonstr)
+	}
+
+	negative := -1.0
+	for _, invalid := range []*Ranking{
+		{NoMedia: &negative},
+		{Fields: map[string]float64{"unknown": 1}},
+		{Recency: RecencyDecay{Scale: "1y", Decay: 0.5}},
+		{Recency: RecencyDecay{Scale: "365d", Decay: 1}},
+		{Catalog: map[string]float64{"mediathek": -1}},
+	} {
+		if err := invalid.Check(); err == nil {
+			t.Errorf("invalid ranking accepted: %+v", invalid)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package search
+
+import "strings"
+
+// maximum number of title and abstract words of the similarity query of engines without more_like_this
+const relatedMaxTerms = 25
+
+/*
+relatedCategories returns the most specific categories of a document.
+the parents are indexed too, but a shared top level category would relate almost everything
+*/
+func relatedCategories(categories []string) []string {
+	result := []string{}
+	for _, cat := range categories {
+		leaf := true
+		for _, other := range categories {
+			if strings.HasPrefix(other, cat+HierarchySeparator) {
+				leaf = false
+				break
+			}
+		}
+		if leaf {
+			result = append(result, cat)
+		}
+	}
+	return result
+}
+
+// relatedPersons returns the names of the persons of a document
+func relatedPersons(doc *SourceData) []string {
+	names := []string{}
+	for _, p := range doc.Persons {
+		if p.Name != "" {
+			names = append(names, p.Name)
+		}
+	}
+	return names
+}
+
+// relatedText returns the first distinct words of title and abstract
+func relatedText(doc *SourceData) string {
+	text := ""
+	if doc.Title != nil {
+		text += doc.Title.String()
+	}
+	if doc.Abstract != nil {
+		text += " " + doc.Abstract.String()
+	}
+	words := []string{}
+	seen := map[string]bool{}
+	for _, word := range wordsRegexp.FindAllString(text, -1) {
+		word = strings.ToLower(word)
+		if len([]rune(word)) < 3 || seen[word] {
+			continue
+		}
+		seen[word] = true
+		words = append(words, word)
+		if len(words) >= relatedMaxTerms {
+			break
+		}
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,66 @@
+package search
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"github.com/bluele/gcache"
+	"github.com/pkg/errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+// resultEntry is a cached result of Search.SearchContext
+type resultEntry struct {
+	highlights []map[string][]string
+	docs       []*SourceData
+	total      int64
+	facets     FacetCountResult
+	next       string
+}
+
+func newResultCache(size int, ttl time.Duration) gcache.Cache {
+	if size <= 0 {
+		return nil
+	}
+	cb := gcache.New(size).LRU()
+	if ttl > 0 {
+		cb = cb.Expiration(ttl)
+	}
+	return cb.Build()
+}
+
+func sortedValues(m map[string][]string) map[string][]string {
+	if m == nil {
+		return nil
+	}
+	result := make(map[string][]string, len(m))
+	for key, vals := range m {
+		vals = slices.Clone(vals)
+		slices.Sort(vals)
+		result[key] = slices.Compact(vals)
+	}
+	return result
+}
+
+/*
+CacheKey identifies the result of cfg. equivalent configurations get the same key:
+the order of groups and filter values does not matter, the debug output is ignored.
+the groups are part of the key, so results are never shared between users with different access rights
+*/
+func (cfg *SearchConfig) CacheKey() ([16]byte, error) {
+	norm := *cfg
+	norm.Debug = nil
+	norm.QStr = strings.TrimSpace(cfg.QStr)
+	norm.Groups = slices.Clone(cfg.Groups)
+	slices.Sort(norm.Groups)
+	norm.Groups = slices.Compact(norm.Groups)
+	norm.Fields = sortedValues(cfg.Fields)
+	norm.FiltersFields = sortedValues(cfg.FiltersFields)
+	// json orders the keys of maps
+	data, err := json.Marshal(norm)
+	if err != nil {
+		return [16]byte{}, errors.Wrap(err, "cannot marshal search config")
+	}
+	return md5.Sum(data), nil
+}
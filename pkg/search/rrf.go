@@ -0,0 +1,27 @@
+package search
+
+import "sort"
+
+// rank constant from the original reciprocal rank fusion paper (Cormack et al. 2009)
+const rrfRankConstant = 60
+
+/*
+reciprocalRankFusion merges ranked id lists. every id gets the sum of 1/(k+rank) over all lists.
+ties keep the order of the first appearance
+*/
+func reciprocalRankFusion(k int, lists ...[]string) []string {
+	scores := map[string]float64{}
+	order := []string{}
+	for _, list := range lists {
+		for rank, id := range list {
+			if _, ok := scores[id]; !ok {
+				order = append(order, id)
+			}
+			scores[id] += 1.0 / float64(k+rank+1)
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return scores[order[i]] > scores[order[j]]
+	})
+	return order
+}
@@ -0,0 +1,20 @@
+package search
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestReciprocalRankFusion(t *testing.T) {
+	lexical := []string{"sig-1", "sig-2", "sig-3"}
+	vector := []string{"sig-4", "sig-2", "sig-5"}
+	fused := reciprocalRankFusion(rrfRankConstant, lexical, vector)
+	expected := []string{"sig-2", "sig-1", "sig-4", "sig-3", "sig-5"}
+	if !slices.Equal(fused, expected) {
+		t.Errorf("unexpected fusion result %v, expected %v", fused, expected)
+	}
+
+	if fused := reciprocalRankFusion(rrfRankConstant, lexical, nil); !slices.Equal(fused, lexical) {
+		t.Errorf("single list must keep its order: %v", fused)
+	}
+}
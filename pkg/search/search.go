@@ -3,154 +3,319 @@ package search
 import (
 	"context"
 	"fmt"
-	badger "github.com/dgraph-io/badger/v4"
+	"github.com/bluele/gcache"
 	"github.com/je4/utils/v2/pkg/zLogger"
 	"github.com/pkg/errors"
-	"go.mongodb.org/mongo-driver/bson"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Search struct {
-	db *badger.DB
-	sync.Mutex
-	log zLogger.ZLogger
-	se  SearchEngine
-	sync.WaitGroup
-	cacheexpiry time.Duration
+	cache    DocumentCache
+	log      zLogger.ZLogger
+	se       SearchEngine
+	timeouts Timeouts
+	// entries stored before the last clearing of the cache are stale (unix nano)
+	cleared atomic.Int64
+	// incremented by every invalidation, documents loaded during an invalidation are not cached
+	generation atomic.Uint64
+	// called after the invalidation of cache entries
+	onInvalidate []func()
+	// results of SearchContext, nil if disabled
+	results gcache.Cache
+	// documents which are loaded from the search engine right now
+	inflightLock sync.Mutex
+	inflight     map[string]*loadCall
 }
 
-type FacetCountResult map[string]map[string]int
+// loadCall is the loading of one document, concurrent requests for the same document wait for it
+type loadCall struct {
+	done chan struct{}
+	doc  *SourceData
+	err  error
+}
 
-type cacheStruct struct {
-	Src       SourceData
-	Timestamp time.Time
+// Timeouts limit the operations of the search engine, 0 is no limit
+type Timeouts struct {
+	Search     time.Duration
+	Stats      time.Duration
+	LastUpdate time.Duration
+	Delete     time.Duration
+	// loading of documents which are not in the cache
+	Load time.Duration
 }
 
-func NewSearch(se SearchEngine, cachesize int, duration time.Duration, db *badger.DB, log zLogger.ZLogger) (*Search, error) {
+type FacetCountResult map[string]map[string]int
+
+func NewSearch(se SearchEngine, cache DocumentCache, log zLogger.ZLogger) (*Search, error) {
 	s := &Search{
-		db:          db,
-		Mutex:       sync.Mutex{},
-		log:         log,
-		se:          se,
-		WaitGroup:   sync.WaitGroup{},
-		cacheexpiry: duration,
+		cache:    cache,
+		log:      log,
+		se:       se,
+		inflight: map[string]*loadCall{},
 	}
 	return s, nil
 }
 
-func (s *Search) clearCache() error {
-	s.Add(1)
-	defer s.Done()
-	return s.db.DropAll()
+func (s *Search) SetTimeouts(timeouts Timeouts) {
+	s.timeouts = timeouts
 }
 
 /*
-cookieStore SourceData in cache
+SetResultCache caches up to size search results for ttl (0 until invalidation).
+size 0 disables the cache
 */
-func (s *Search) storeCache(src *SourceData) error {
-	s.Wait()
-	jsonstr, err := bson.Marshal(cacheStruct{
-		Src:       *src,
-		Timestamp: time.Now(),
-	})
-	if err != nil {
-		return errors.Wrapf(err, "cannot marshal source data of %v", src.Signature)
+func (s *Search) SetResultCache(size int, ttl time.Duration) {
+	s.results = newResultCache(size, ttl)
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+/*
+clearCache removes all documents from the cache.
+readers are not blocked, entries which are read while dropping are stale because of their timestamp
+*/
+func (s *Search) clearCache() error {
+	s.cleared.Store(time.Now().UnixNano())
+	s.invalidated()
+	return s.cache.Clear()
+}
+
+// OnInvalidate registers f to be called whenever cached documents are invalidated
+func (s *Search) OnInvalidate(f func()) {
+	s.onInvalidate = append(s.onInvalidate, f)
+}
+
+func (s *Search) invalidated() {
+	s.generation.Add(1)
+	if s.results != nil {
+		s.results.Purge()
+	}
+	for _, f := range s.onInvalidate {
+		f()
 	}
-	data := Compress([]byte(jsonstr))
-	if err := s.db.Update(func(txn *badger.Txn) error {
-		return txn.Set([]byte(src.Signature), data)
-	}); err != nil {
-		return err
+}
+
+// InvalidateCache removes the documents with the given signatures from the cache
+func (s *Search) InvalidateCache(signatures ...string) error {
+	s.invalidated()
+	if err := s.cache.Delete(signatures...); err != nil {
+		return errors.Wrapf(err, "cannot invalidate %v", signatures)
 	}
+	s.log.Info().Msgf("cache invalidated: %v", signatures)
+	return nil
+}
+
+// InvalidateCachePrefix removes all documents with signatures starting with prefix from the cache
+func (s *Search) InvalidateCachePrefix(prefix string) error {
+	if prefix == "" {
+		return s.clearCache()
+	}
+	s.invalidated()
+	if err := s.cache.DeletePrefix(prefix); err != nil {
+		return errors.Wrapf(err, "cannot invalidate prefix %s", prefix)
+	}
+	s.log.Info().Msgf("cache invalidated: %s*", prefix)
 	return nil
 }
 
 /*
-retrieve SourceData from cache
+WatchUpdates polls the search engine until ctx is done.
+if another instance changed the index (newer last update or another number of documents), all cached documents become stale.
+this keeps replicas sharing an index in sync
 */
-func (s *Search) getFromCache(id string) (*SourceData, error) {
-	s.Wait()
-	var result *SourceData
-	if err := s.db.View(func(txn *badger.Txn) error {
-		it, err := txn.Get([]byte(id))
+func (s *Search) WatchUpdates(ctx context.Context, interval time.Duration) {
+	var lastUpdate time.Time
+	var lastTotal int64 = -1
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		last, err := s.LastUpdateContext(ctx, &ScrollConfig{IsAdmin: true})
 		if err != nil {
-			return errors.Wrapf(err, "cannot get item %s", id)
+			s.log.Error().Msgf("cannot watch updates: %v", err)
 		}
-		if it == nil {
-			return fmt.Errorf("item %s not in cache", id)
+		total, _, err2 := s.StatsByACLContext(ctx, nil)
+		if err2 != nil {
+			s.log.Error().Msgf("cannot watch updates: %v", err2)
 		}
-		if err := it.Value(func(v []byte) error {
-			var doc = &cacheStruct{}
-
-			// decompress...
-			data, err := Decompress(v)
-			if err != nil {
-				return errors.Wrapf(err, "cannot deocmpress %s", string(v))
-			}
-			// ...unmarshal
-			if err := bson.Unmarshal(data, doc); err != nil {
-				return errors.Wrapf(err, "cannot unmarshal json %s", string(v))
+		if err == nil && err2 == nil {
+			if lastTotal >= 0 && (last.After(lastUpdate) || total != lastTotal) {
+				s.log.Info().Msgf("index changed (last update %v, %d documents), cache invalidated", last, total)
+				// lazy: stale entries are replaced on the next load
+				s.cleared.Store(time.Now().UnixNano())
+				s.invalidated()
 			}
+			lastUpdate, lastTotal = last, total
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
 
-			// check cache expiration
-			if time.Now().After(doc.Timestamp.Add(s.cacheexpiry)) {
-				s.log.Info().Msgf("timestamp %v", doc.Timestamp.String())
-				return fmt.Errorf("timestamp %v", doc.Timestamp.String())
-			} else {
-				s.log.Info().Msgf("document %s found in cache", id)
-			}
-			result = &doc.Src
-			return nil
-		}); err != nil {
-			return errors.Wrapf(err, "cannot load item %s", id)
+/*
+Maintain sweeps the document cache until ctx is done
+*/
+func (s *Search) Maintain(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := s.cache.Sweep(); err != nil {
+			s.log.Error().Msgf("cannot sweep cache: %v", err)
 		}
-		return nil
-	}); err != nil {
-		return nil, errors.Wrap(err, "item not found")
+		stats := s.cache.Stats()
+		s.log.Info().Msgf("%s cache: %d hits, %d misses, %d evictions, %d expired", stats.Backend, stats.Hits, stats.Misses, stats.Evictions, stats.Expired)
 	}
-	return result, nil
 }
 
-func (s *Search) LoadEntities(ids []string) (map[string]*SourceData, error) {
-	// todo: need better locking stragegy
-	s.Lock()
-	defer s.Unlock()
+// CacheStats returns the counters of the document cache and the result cache
+func (s *Search) CacheStats() (CacheStats, CacheStats) {
+	results := CacheStats{Backend: "results", Entries: 0}
+	if s.results != nil {
+		results.Hits = int64(s.results.HitCount())
+		results.Misses = int64(s.results.MissCount())
+		results.Entries = int64(s.results.Len(false))
+	}
+	return s.cache.Stats(), results
+}
 
+/*
+retrieve SourceData from cache
+*/
+func (s *Search) getFromCache(id string) (*SourceData, error) {
+	doc, timestamp, err := s.cache.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	// stored before the last invalidation of the whole cache
+	if timestamp.UnixNano() < s.cleared.Load() {
+		return nil, ErrCacheMiss
+	}
+	s.log.Debug().Msgf("document %s found in cache", id)
+	return doc, nil
+}
+
+/*
+LoadEntities loads the documents from the cache or the search engine.
+concurrent calls run in parallel, only one of them loads a document which is not in the cache.
+every caller gets its own documents, only the references of them may be changed
+*/
+func (s *Search) LoadEntities(ctx context.Context, ids []string) (map[string]*SourceData, error) {
 	var result = make(map[string]*SourceData)
 	var toLoad []string
+	var own = make(map[string]*loadCall)
+	var foreign = make(map[string]*loadCall)
 
 	//
 	// try loading from cache
 	//
 	for _, id := range ids {
+		if _, ok := own[id]; ok {
+			continue
+		}
+		if _, ok := foreign[id]; ok {
+			continue
+		}
 		doc, err := s.getFromCache(id)
-		if err != nil {
-			toLoad = append(toLoad, id)
-		} else {
+		if err != nil && !errors.Is(err, ErrCacheMiss) {
+			s.log.Error().Msgf("cannot read %s from cache: %v", id, err)
+		}
+		if err == nil {
 			if doc.Source != "" {
 				result[doc.Signature] = doc
 			}
+			continue
 		}
+		s.inflightLock.Lock()
+		if call, ok := s.inflight[id]; ok {
+			foreign[id] = call
+		} else {
+			call = &loadCall{done: make(chan struct{})}
+			s.inflight[id] = call
+			own[id] = call
+			toLoad = append(toLoad, id)
+		}
+		s.inflightLock.Unlock()
 	}
 
 	//
 	// then load the rest from index
 	//
-	entries, err := s.se.LoadDocs(toLoad, context.Background())
-	if err != nil {
-		return nil, errors.Wrapf(err, "cannot load entities %v", ids)
+	if len(toLoad) > 0 {
+		generation := s.generation.Load()
+		loadCtx, cancel := withTimeout(ctx, s.timeouts.Load)
+		entries, err := s.se.LoadDocs(toLoad, loadCtx)
+		cancel()
+		if err != nil {
+			err = errors.Wrapf(err, "cannot load entities %v", toLoad)
+		}
+		// cookieStore results in cache, if they were not invalidated while loading
+		for _, sdata := range entries {
+			result[sdata.Signature] = sdata
+			if s.generation.Load() == generation {
+				if err := s.cache.Set(sdata); err != nil {
+					s.log.Error().Msgf("cannot cache %s: %v", sdata.Signature, err)
+				}
+			}
+		}
+		s.inflightLock.Lock()
+		for id, call := range own {
+			call.doc, call.err = entries[id], err
+			delete(s.inflight, id)
+			close(call.done)
+		}
+		s.inflightLock.Unlock()
+		if err != nil {
+			return nil, err
+		}
 	}
-	// cookieStore results in cache
-	for _, sdata := range entries {
-		result[sdata.Signature] = sdata
-		_ = s.storeCache(sdata)
+
+	//
+	// wait for the documents which are loaded by others
+	//
+	for id, call := range foreign {
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if call.err != nil {
+			// the request which loaded the document was canceled, not this one
+			if errors.Is(call.err, context.Canceled) || errors.Is(call.err, context.DeadlineExceeded) {
+				docs, err := s.LoadEntities(ctx, []string{id})
+				if err != nil {
+					return nil, err
+				}
+				for sig, doc := range docs {
+					result[sig] = doc
+				}
+				continue
+			}
+			return nil, errors.Wrapf(call.err, "cannot load entity %s", id)
+		}
+		// the loading request owns call.doc
+		if call.doc != nil {
+			result[call.doc.Signature] = call.doc.Copy()
+		}
 	}
 	return result, nil
 }
 
-func (s *Search) LoadEntity(id string) (*SourceData, error) {
-	entities, err := s.LoadEntities([]string{id})
+func (s *Search) LoadEntity(ctx context.Context, id string) (*SourceData, error) {
+	entities, err := s.LoadEntities(ctx, []string{id})
 	if err != nil {
 		return nil, err
 	}
@@ -162,14 +327,123 @@ func (s *Search) LoadEntity(id string) (*SourceData, error) {
 }
 
 func (s *Search) StatsByACL(catalog []string) (int64, FacetCountResult, error) {
-	total, result, err := s.se.StatsByACL(catalog)
+	return s.StatsByACLContext(context.Background(), catalog)
+}
+
+func (s *Search) StatsByACLContext(ctx context.Context, catalog []string) (int64, FacetCountResult, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Stats)
+	defer cancel()
+	total, result, err := s.se.StatsByACLContext(ctx, catalog)
 	return total, result, err
 }
 
-func (s *Search) Search(cfg *SearchConfig) ([]map[string][]string, []*SourceData, int64, FacetCountResult, error) {
-	highlights, result, num, fts, err := s.se.Search(cfg)
+func (s *Search) Search(cfg *SearchConfig) ([]map[string][]string, []*SourceData, int64, FacetCountResult, string, error) {
+	return s.SearchContext(context.Background(), cfg)
+}
+
+/*
+SearchContext searches the documents visible with cfg.
+results are cached if the result cache is enabled and no debug output is requested.
+the documents of cached results are shared, they must not be modified
+*/
+func (s *Search) SearchContext(ctx context.Context, cfg *SearchConfig) ([]map[string][]string, []*SourceData, int64, FacetCountResult, string, error) {
+	var key [16]byte
+	results := s.results
+	if results != nil && cfg.Debug == nil {
+		var err error
+		key, err = cfg.CacheKey()
+		if err != nil {
+			return nil, nil, 0, nil, "", errors.Wrap(err, "cannot create cache key")
+		}
+		if entry, err := results.Get(key); err == nil {
+			re := entry.(*resultEntry)
+			return re.highlights, re.docs, re.total, re.facets, re.next, nil
+		}
+	} else {
+		results = nil
+	}
+	generation := s.generation.Load()
+	ctx, cancel := withTimeout(ctx, s.timeouts.Search)
+	defer cancel()
+	highlights, result, num, fts, next, err := s.se.SearchContext(ctx, cfg)
+	if err != nil {
+		return nil, nil, 0, nil, "", errors.Wrap(err, "cannot search")
+	}
+	// no results from before an invalidation
+	if results != nil && s.generation.Load() == generation {
+		_ = results.Set(key, &resultEntry{
+			highlights: highlights,
+			docs:       result,
+			total:      num,
+			facets:     fts,
+			next:       next,
+		})
+	}
+	return highlights, result, num, fts, next, nil
+}
+
+func (s *Search) LastUpdateContext(ctx context.Context, cfg *ScrollConfig) (time.Time, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.LastUpdate)
+	defer cancel()
+	last, err := s.se.LastUpdateContext(ctx, cfg)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "cannot get last update")
+	}
+	return last, nil
+}
+
+func (s *Search) DeleteContext(ctx context.Context, cfg *ScrollConfig) (int64, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Delete)
+	defer cancel()
+	num, err := s.se.DeleteContext(ctx, cfg)
 	if err != nil {
-		return nil, nil, 0, nil, errors.Wrap(err, "cannot search")
+		return 0, errors.Wrap(err, "cannot delete")
+	}
+	return num, nil
+}
+
+func (s *Search) Suggest(ctx context.Context, cfg *SearchConfig) ([]Suggestion, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Search)
+	defer cancel()
+	result, err := s.se.Suggest(ctx, cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get suggestions")
+	}
+	return result, nil
+}
+
+func (s *Search) DidYouMean(ctx context.Context, cfg *SearchConfig) ([]SpellSuggestion, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Search)
+	defer cancel()
+	result, err := s.se.DidYouMean(ctx, cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get spelling suggestions")
+	}
+	return result, nil
+}
+
+func (s *Search) Related(ctx context.Context, doc *SourceData, cfg *SearchConfig) ([]*SourceData, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Search)
+	defer cancel()
+	result, err := s.se.Related(ctx, doc, cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot find related documents")
+	}
+	return result, nil
+}
+
+// SetRanking replaces the weights of the relevance search
+func (s *Search) SetRanking(r *Ranking) {
+	s.se.SetRanking(r)
+	if s.results != nil {
+		s.results.Purge()
+	}
+}
+
+// SearchModes returns the search modes supported by the search engine
+func (s *Search) SearchModes() []SearchMode {
+	if smp, ok := s.se.(SearchModeProvider); ok {
+		return smp.SearchModes()
 	}
-	return highlights, result, num, fts, nil
+	return []SearchMode{SearchModeLexical}
 }
@@ -0,0 +1,78 @@
+package search
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+/*
+SearchDebug is filled by the search engine if it is set in SearchConfig.Debug.
+it shows administrators the generated queries, the scores of the hits with their explanation and the time needed
+*/
+type SearchDebug struct {
+	Engine  string             `json:"engine"`
+	Queries []SearchDebugQuery `json:"queries"`
+	// time of the complete search including the transfer of the documents, set by the caller
+	Duration int64 `json:"duration_ms"`
+}
+
+type SearchDebugQuery struct {
+	Name  string          `json:"name"`
+	Query json.RawMessage `json:"query"`
+	// time reported by the search engine
+	Took int64            `json:"took_ms"`
+	Hits []SearchDebugHit `json:"hits"`
+}
+
+type SearchDebugHit struct {
+	Signature   string          `json:"signature"`
+	Score       float64         `json:"score"`
+	Explanation json.RawMessage `json:"explanation,omitempty"`
+}
+
+// addQuery appends a query, the hits are added to the returned entry
+func (sd *SearchDebug) addQuery(name string, query interface{}, took time.Duration) (*SearchDebugQuery, error) {
+	data, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+	sd.Queries = append(sd.Queries, SearchDebugQuery{
+		Name:  name,
+		Query: data,
+		Took:  took.Milliseconds(),
+		Hits:  []SearchDebugHit{},
+	})
+	return &sd.Queries[len(sd.Queries)-1], nil
+}
+
+func (sdq *SearchDebugQuery) addHit(signature string, score float64, explanation interface{}) error {
+	hit := SearchDebugHit{Signature: signature, Score: score}
+	if explanation != nil {
+		data, err := json.Marshal(explanation)
+		if err != nil {
+			return err
+		}
+		hit.Explanation = data
+	}
+	sdq.Hits = append(sdq.Hits, hit)
+	return nil
+}
+
+// QueryString is the indented query for the debug panel
+func (sdq SearchDebugQuery) QueryString() string {
+	return indentJSON(sdq.Query)
+}
+
+// ExplanationString is the indented explanation for the debug panel
+func (sdh SearchDebugHit) ExplanationString() string {
+	return indentJSON(sdh.Explanation)
+}
+
+func indentJSON(data json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return string(data)
+	}
+	return buf.String()
+}
@@ -2,13 +2,81 @@ package search
 
 import (
 	"context"
+	"github.com/pkg/errors"
+	"strings"
 	"time"
 )
 
+// ErrUnavailable is part of the errors of a search engine which cannot be reached or is overloaded
+var ErrUnavailable = errors.New("search engine unavailable")
+
+type FacetType string
+
+const (
+	FacetTypeTerms         FacetType = "terms"
+	FacetTypeHierarchy     FacetType = "hierarchy"
+	FacetTypeRange         FacetType = "range"
+	FacetTypeDateHistogram FacetType = "date_histogram"
+)
+
 type TermFacet struct {
 	Selected map[string]bool
 	Prefix   string
 	Limit    int64
+	// empty for FacetTypeTerms
+	Type FacetType
+}
+
+// FacetRange is a bucket of a range facet. zero times are open bounds, To is exclusive
+type FacetRange struct {
+	Key  string
+	From time.Time
+	To   time.Time
+}
+
+/*
+RangeFacet counts documents in date ranges (FacetTypeRange) or per calendar interval (FacetTypeDateHistogram).
+Interval is one of year, month or day. the counts are returned in FacetCountResult with the range key or the formatted date as value
+*/
+type RangeFacet struct {
+	Field    string
+	Type     FacetType
+	Interval string
+	Ranges   []FacetRange
+}
+
+// RangeFilter restricts a date field, zero times are open bounds, To is exclusive
+type RangeFilter struct {
+	Field string
+	From  time.Time
+	To    time.Time
+}
+
+type SearchMode string
+
+const (
+	SearchModeLexical  SearchMode = "lexical"
+	SearchModeSemantic SearchMode = "semantic"
+	SearchModeHybrid   SearchMode = "hybrid"
+)
+
+var SearchModes = []SearchMode{SearchModeLexical, SearchModeSemantic, SearchModeHybrid}
+
+func ParseSearchMode(str string) (SearchMode, bool) {
+	if str == "" {
+		return SearchModeLexical, true
+	}
+	for _, mode := range SearchModes {
+		if string(mode) == str {
+			return mode, true
+		}
+	}
+	return SearchModeLexical, false
+}
+
+// SearchModeProvider is implemented by search engines which support more than SearchModeLexical
+type SearchModeProvider interface {
+	SearchModes() []SearchMode
 }
 
 type SearchConfig struct {
@@ -16,11 +84,31 @@ type SearchConfig struct {
 	QStr           string
 	FiltersFields  map[string][]string
 	Facets         map[string]TermFacet
+	RangeFacets    map[string]RangeFacet
+	RangeFilters   []RangeFilter
 	Groups         []string
 	ContentVisible bool
 	Start          int
 	Rows           int
 	IsAdmin        bool
+	Mode           SearchMode
+	// opaque position from a previous result, replaces Start
+	Cursor string
+	Sort   SortOrder
+	// language of the user for the title sort and the language fields of the query, "" searches without language
+	Lang string
+	// if set, Search explains the ranking
+	Debug *SearchDebug `bson:"-"`
+}
+
+// rankedBySimilarity reports whether the hits are ranked by the vector similarity, which cannot be sorted
+func rankedBySimilarity(mode SearchMode, qstr string) bool {
+	return (mode == SearchModeSemantic || mode == SearchModeHybrid) && strings.TrimSpace(qstr) != ""
+}
+
+// TotalEstimated reports whether the number of hits is estimated, like the fused hits of the hybrid search
+func (cfg *SearchConfig) TotalEstimated() bool {
+	return cfg.Mode == SearchModeHybrid && strings.TrimSpace(cfg.QStr) != ""
 }
 
 type ScrollConfig struct {
@@ -30,15 +118,27 @@ type ScrollConfig struct {
 	Groups         []string
 	ContentVisible bool
 	IsAdmin        bool
+	// checkpoint: scroll continues after the document with this signature
+	After string
 }
 
 type SearchEngine interface {
 	Update(source *SourceData) error
 	UpdateTimestamp(source *SourceData, timestamp time.Time) error
 	LoadDocs(ids []string, ctx context.Context) (map[string]*SourceData, error)
-	Search(cfg *SearchConfig) ([]map[string][]string, []*SourceData, int64, FacetCountResult, error)
-	Delete(cfg *ScrollConfig) (int64, error)
-	StatsByACL(catalog []string) (int64, FacetCountResult, error)
-	LastUpdate(cfg *ScrollConfig) (time.Time, error)
-	Scroll(cfg *ScrollConfig, f func(data *SourceData) error) error
+	// SearchContext returns the highlights, the documents, the total number of hits, the facets and the cursor of the next page
+	SearchContext(ctx context.Context, cfg *SearchConfig) ([]map[string][]string, []*SourceData, int64, FacetCountResult, string, error)
+	DeleteContext(ctx context.Context, cfg *ScrollConfig) (int64, error)
+	StatsByACLContext(ctx context.Context, catalog []string) (int64, FacetCountResult, error)
+	LastUpdateContext(ctx context.Context, cfg *ScrollConfig) (time.Time, error)
+	// Suggest completes the text in cfg.QStr with values of the documents visible with cfg
+	Suggest(ctx context.Context, cfg *SearchConfig) ([]Suggestion, error)
+	// DidYouMean returns corrections of cfg.QStr which have hits visible with cfg
+	DidYouMean(ctx context.Context, cfg *SearchConfig) ([]SpellSuggestion, error)
+	// Related returns the documents similar to doc which are visible with cfg
+	Related(ctx context.Context, doc *SourceData, cfg *SearchConfig) ([]*SourceData, error)
+	// SetRanking replaces the weights of the relevance search
+	SetRanking(r *Ranking)
+	// Scroll calls f for all documents in the order of the signature
+	Scroll(ctx context.Context, cfg *ScrollConfig, f func(data *SourceData) error) error
 }
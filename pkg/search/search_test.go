@@ -0,0 +1,262 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/rs/zerolog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowEngine loads documents with the latency of a remote search engine
+type slowEngine struct {
+	SearchEngine
+	latency  time.Duration
+	loads    atomic.Int64
+	searches atomic.Int64
+	// index state for WatchUpdates (unix nano of the last update, number of documents)
+	lastUpdate atomic.Int64
+	total      atomic.Int64
+}
+
+func (se *slowEngine) LastUpdateContext(ctx context.Context, cfg *ScrollConfig) (time.Time, error) {
+	return time.Unix(0, se.lastUpdate.Load()), nil
+}
+
+func (se *slowEngine) StatsByACLContext(ctx context.Context, catalog []string) (int64, FacetCountResult, error) {
+	return se.total.Load(), FacetCountResult{}, nil
+}
+
+func (se *slowEngine) LoadDocs(ids []string, ctx context.Context) (map[string]*SourceData, error) {
+	se.loads.Add(int64(len(ids)))
+	select {
+	case <-time.After(se.latency):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	result := map[string]*SourceData{}
+	for _, id := range ids {
+		result[id] = &SourceData{Signature: id, Source: "test"}
+	}
+	return result, nil
+}
+
+func (se *slowEngine) SearchContext(ctx context.Context, cfg *SearchConfig) ([]map[string][]string, []*SourceData, int64, FacetCountResult, string, error) {
+	se.searches.Add(1)
+	time.Sleep(se.latency)
+	return nil, []*SourceData{{Signature: cfg.QStr, Source: "test"}}, 1, nil, "", nil
+}
+
+func newTestSearch(t testing.TB, expiry time.Duration, latency time.Duration) (*Search, *slowEngine) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatalf("cannot open badger: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	logger := zerolog.Nop()
+	se := &slowEngine{latency: latency}
+	s, err := NewSearch(se, NewBadgerCache(db, expiry), &logger)
+	if err != nil {
+		t.Fatalf("cannot create search: %v", err)
+	}
+	return s, se
+}
+
+func TestLoadEntitiesShared(t *testing.T) {
+	s, se := newTestSearch(t, time.Hour, 50*time.Millisecond)
+	var wg sync.WaitGroup
+	docs := make([]*SourceData, 20)
+	for i := 0; i < len(docs); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			doc, err := s.LoadEntity(context.Background(), "sig1")
+			if err != nil || doc.Signature != "sig1" {
+				t.Errorf("cannot load sig1: %v", err)
+				return
+			}
+			docs[i] = doc
+		}(i)
+	}
+	wg.Wait()
+	if loads := se.loads.Load(); loads != 1 {
+		t.Errorf("sig1 loaded %d times from the search engine", loads)
+	}
+	// every request may change its document
+	for i := 1; i < len(docs); i++ {
+		if docs[i] == docs[0] {
+			t.Errorf("request %d shares the document of request 0", i)
+		}
+	}
+
+	if err := s.clearCache(); err != nil {
+		t.Fatalf("cannot clear cache: %v", err)
+	}
+	if _, err := s.LoadEntity(context.Background(), "sig1"); err != nil {
+		t.Fatalf("cannot load sig1: %v", err)
+	}
+	if loads := se.loads.Load(); loads != 2 {
+		t.Errorf("sig1 not reloaded after clearing the cache")
+	}
+}
+
+// a waiting request loads the document itself if the loading request is canceled
+func TestLoadEntitiesCanceled(t *testing.T) {
+	s, _ := newTestSearch(t, time.Hour, 100*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	errs := make(chan error, 1)
+	go func() {
+		_, err := s.LoadEntity(ctx, "sig1")
+		errs <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+	doc, err := s.LoadEntity(context.Background(), "sig1")
+	if err != nil || doc.Signature != "sig1" {
+		t.Errorf("cannot load sig1: %v", err)
+	}
+	if err := <-errs; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("canceled request did not fail: %v", err)
+	}
+}
+
+/*
+BenchmarkLoadEntities loads different documents in parallel without cache hits.
+"serialized" is the former global lock of LoadEntities
+*/
+func BenchmarkLoadEntities(b *testing.B) {
+	for _, serialized := range []bool{true, false} {
+		name := "concurrent"
+		if serialized {
+			name = "serialized"
+		}
+		b.Run(name, func(b *testing.B) {
+			s, _ := newTestSearch(b, 0, time.Millisecond)
+			var lock sync.Mutex
+			var counter atomic.Int64
+			b.SetParallelism(16)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					id := fmt.Sprintf("sig%d", counter.Add(1))
+					if serialized {
+						lock.Lock()
+					}
+					_, err := s.LoadEntity(context.Background(), id)
+					if serialized {
+						lock.Unlock()
+					}
+					if err != nil {
+						b.Errorf("cannot load %s: %v", id, err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestInvalidateCache(t *testing.T) {
+	s, se := newTestSearch(t, time.Hour, 0)
+	if _, err := s.LoadEntities(context.Background(), []string{"a-1", "a-2", "b-1"}); err != nil {
+		t.Fatalf("cannot load entities: %v", err)
+	}
+	if err := s.InvalidateCachePrefix("a-"); err != nil {
+		t.Fatalf("cannot invalidate a-: %v", err)
+	}
+	if err := s.InvalidateCache("b-1"); err != nil {
+		t.Fatalf("cannot invalidate b-1: %v", err)
+	}
+	for _, id := range []string{"a-1", "a-2", "b-1"} {
+		if _, err := s.getFromCache(id); err == nil {
+			t.Errorf("%s still in cache", id)
+		}
+	}
+	if _, err := s.LoadEntities(context.Background(), []string{"a-1", "b-1"}); err != nil {
+		t.Fatalf("cannot load entities: %v", err)
+	}
+	if loads := se.loads.Load(); loads != 5 {
+		t.Errorf("%d documents loaded from the search engine instead of 5", loads)
+	}
+}
+
+func TestResultCache(t *testing.T) {
+	s, se := newTestSearch(t, time.Hour, 0)
+	s.SetResultCache(10, time.Hour)
+	for _, cfg := range []*SearchConfig{
+		{QStr: "kunst", Groups: []string{"global/guest", "global/admin"}, FiltersFields: map[string][]string{"catalog": {"a", "b"}}},
+		{QStr: " kunst", Groups: []string{"global/admin", "global/guest"}, FiltersFields: map[string][]string{"catalog": {"b", "a"}}},
+		{QStr: "kunst", Groups: []string{"global/admin", "global/guest", "global/guest"}, FiltersFields: map[string][]string{"catalog": {"b", "a"}}},
+	} {
+		if _, _, _, _, _, err := s.Search(cfg); err != nil {
+			t.Fatalf("cannot search: %v", err)
+		}
+	}
+	if searches := se.searches.Load(); searches != 1 {
+		t.Errorf("%d searches instead of 1", searches)
+	}
+	// other groups, debug output and invalidation are not served from the cache
+	for _, cfg := range []*SearchConfig{
+		{QStr: "kunst", Groups: []string{"global/guest"}, FiltersFields: map[string][]string{"catalog": {"a", "b"}}},
+		{QStr: "kunst", Groups: []string{"global/guest"}, FiltersFields: map[string][]string{"catalog": {"a", "b"}}, Debug: &SearchDebug{}},
+	} {
+		if _, _, _, _, _, err := s.Search(cfg); err != nil {
+			t.Fatalf("cannot search: %v", err)
+		}
+	}
+	if err := s.InvalidateCache("kunst"); err != nil {
+		t.Fatalf("cannot invalidate: %v", err)
+	}
+	if _, _, _, _, _, err := s.Search(&SearchConfig{QStr: "kunst", Groups: []string{"global/guest"}, FiltersFields: map[string][]string{"catalog": {"a", "b"}}}); err != nil {
+		t.Fatalf("cannot search: %v", err)
+	}
+	if searches := se.searches.Load(); searches != 4 {
+		t.Errorf("%d searches instead of 4", searches)
+	}
+}
+
+func TestWatchUpdates(t *testing.T) {
+	s, se := newTestSearch(t, time.Hour, 0)
+	se.lastUpdate.Store(time.Now().Add(-time.Hour).UnixNano())
+	se.total.Store(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.WatchUpdates(ctx, time.Millisecond)
+
+	waitFor := func(generation uint64) bool {
+		for i := 0; i < 500; i++ {
+			if s.generation.Load() > generation {
+				return true
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return false
+	}
+	time.Sleep(10 * time.Millisecond)
+	if _, err := s.LoadEntity(context.Background(), "sig1"); err != nil {
+		t.Fatalf("cannot load sig1: %v", err)
+	}
+	generation := s.generation.Load()
+	if generation != 0 {
+		t.Fatalf("cache invalidated without change of the index")
+	}
+
+	// an update of an existing document keeps the number of documents
+	se.lastUpdate.Store(time.Now().UnixNano())
+	if !waitFor(generation) {
+		t.Fatalf("newer timestamp did not invalidate the cache")
+	}
+	if _, err := s.getFromCache("sig1"); err == nil {
+		t.Errorf("sig1 not stale after the update")
+	}
+
+	generation = s.generation.Load()
+	se.total.Add(-1)
+	if !waitFor(generation) {
+		t.Fatalf("deletion did not invalidate the cache")
+	}
+}
@@ -28,7 +28,6 @@ import (
 	"fmt"
 	"github.com/Masterminds/sprig"
 	"github.com/bluele/gcache"
-	"github.com/drgrib/maps"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/securecookie"
@@ -95,6 +94,7 @@ type DetailStatus struct {
 	IsAmp             bool
 	MetaDescription   string
 	Result            *SearchResult
+	Related           *SearchResult
 	SearchResultRows  int
 	SearchResultTotal int
 	FacebookAppId     string
@@ -116,14 +116,26 @@ type SearchStatus struct {
 	SearchResultStart   int
 	SearchResultRows    int
 	SearchResultTotal   int
+	SearchResultNext    string
+	DidYouMean          []SpellSuggestion
+	Debug               *SearchDebug
 	SearchString        string
 	Filter              map[string][]string
 	SearchResultVisible bool
 	Facet               map[string]map[string]FacetCountField
+	FacetTree           map[string][]*FacetNode
 	CoreFacets          []string
 	MetaDescription     string
 	EmptySearch         bool
 	Stats               FacetCountResult
+	SearchMode          string
+	SearchModes         []string
+	SearchSort          string
+	SearchSorts         []SortOrder
+	DateFacet           map[string][]FacetCountField
+	DateFacetSelected   map[string]string
+	FeedAtom            template.URL
+	FeedRSS             template.URL
 }
 
 type CollectionsStatus struct {
@@ -189,14 +201,18 @@ type facetField struct {
 }
 
 type SearchResult struct {
-	Items           []SearchResultItem    `json:"items"`
-	Total           int64                 `json:"total"`
-	Start           int64                 `json:"SearchResultStart"`
-	Rows            int64                 `json:"Rows"`
-	Query           string                `json:"query"`
-	Search          string                `json:"search"`
-	Next            string                `json:"next"`
-	FacetFieldCount map[string]facetField `json:"facetfieldcount"`
+	Items           []SearchResultItem      `json:"items"`
+	Total           int64                   `json:"total"`
+	Start           int64                   `json:"SearchResultStart"`
+	Rows            int64                   `json:"Rows"`
+	Query           string                  `json:"query"`
+	Search          string                  `json:"search"`
+	Next            string                  `json:"next"`
+	FacetFieldCount map[string]facetField   `json:"facetfieldcount"`
+	FacetTree       map[string][]*FacetNode `json:"facettree,omitempty"`
+	DateFacetCount  FacetCountResult        `json:"datefacetcount,omitempty"`
+	// total is not exact (hybrid search)
+	TotalEstimated bool `json:"totalestimated,omitempty"`
 }
 
 type SearchResultItem struct {
@@ -428,6 +444,7 @@ type Server struct {
 	sessionTimeout      time.Duration
 	templateDir         string
 	facebookAppId       string
+	analytics           *Analytics
 }
 
 func NewServer(
@@ -562,6 +579,8 @@ func NewServer(
 		SameSite: http.SameSiteLaxMode, // http.SameSiteStrictMode,
 		Path:     "/",
 	}
+	// rendered search results may contain invalidated documents
+	mts.OnInvalidate(func() { srv.queryCache.Purge() })
 	if err := srv.InitTemplates(); err != nil {
 		return nil, errors.Wrapf(err, "cannot initialize server")
 	}
@@ -748,6 +767,21 @@ func mediaserverUri2ColSig(uri string) (string, string, error) {
 	return matches[1], matches[2], nil
 }
 
+/*
+searchErrorStatus is the http status of a failed search: 504 if the search took too long,
+503 if the search engine cannot be reached (or the client is gone, the answer is not read anyway)
+*/
+func searchErrorStatus(w http.ResponseWriter, err error) int {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, ErrUnavailable), errors.Is(err, context.Canceled):
+		w.Header().Set("Retry-After", "30")
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
 func (s *Server) DoPanicf(user *User, req *http.Request, writer http.ResponseWriter, status int, message string, json bool, a ...interface{}) (err error) {
 	msg := fmt.Sprintf(message, a...)
 	if json {
@@ -1064,6 +1098,18 @@ func (s *Server) ListenAndServe(cert, key string) error {
 		),
 	).
 		Methods("POST")
+	router.Handle(
+		fmt.Sprintf("/%s/clearcache/{prefix}", s.prefixes["api"]), JWTInterceptor.JWTInterceptor(
+			s.service,
+			"ClearCache",
+			JWTInterceptor.Secure,
+			func() http.Handler { return http.HandlerFunc(s.apiHandlerInvalidateCache) }(),
+			s.jwtKey,
+			s.jwtAlg,
+			sha512.New(),
+			s.log,
+		)).
+		Methods("POST")
 	router.Handle(
 		fmt.Sprintf("/%s/signatures/{prefix}", s.prefixes["api"]), JWTInterceptor.JWTInterceptor(
 			s.service,
@@ -1101,6 +1147,13 @@ func (s *Server) ListenAndServe(cert, key string) error {
 		)).
 		Methods("GET")
 	router.HandleFunc(fmt.Sprintf("/%s/ping", s.prefixes["api"]), s.apiHandlerPing).Methods("GET")
+	router.HandleFunc(fmt.Sprintf("/%s/signatures/{signature}", s.prefixes["api"]), s.apiHandlerSignature).Methods("GET")
+	router.HandleFunc(fmt.Sprintf("/%s/search", s.prefixes["api"]), s.apiHandlerSearch).Methods("GET")
+	router.HandleFunc(fmt.Sprintf("/%s/%s/search", s.prefixes["api"], QueryApiVersion), s.apiHandlerSearch).Methods("GET")
+	router.HandleFunc(fmt.Sprintf("/%s/suggest", s.prefixes["api"]), s.apiHandlerSuggest).Methods("GET")
+	router.HandleFunc(fmt.Sprintf("/%s/%s/suggest", s.prefixes["api"], QueryApiVersion), s.apiHandlerSuggest).Methods("GET")
+	router.HandleFunc(fmt.Sprintf("/%s/analytics", s.prefixes["api"]), s.apiHandlerAnalytics).Methods("GET")
+	router.HandleFunc(fmt.Sprintf("/%s/cachestats", s.prefixes["api"]), s.apiHandlerCacheStats).Methods("GET")
 
 	loggedRouter := handlers.CombinedLoggingHandler(s.accesslog, handlers.ProxyHeaders(router))
 	addr := net.JoinHostPort(s.host, s.port)
@@ -1130,6 +1183,12 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	return s.srv.Shutdown(ctx)
 }
 
+// SetRanking replaces the weights of the relevance search, cached result pages of the old ranking are dropped
+func (s *Server) SetRanking(r *Ranking) {
+	s.mts.SetRanking(r)
+	s.queryCache.Purge()
+}
+
 func (s *Server) GetClaimUser(claims map[string]interface{}) (*User, error) {
 	id, err := GetClaim(claims, "userId")
 	if err != nil {
@@ -1165,52 +1224,100 @@ func (s *Server) GetClaimUser(claims map[string]interface{}) (*User, error) {
 	return u, nil
 }
 
-// var rexp = regexp.MustCompile(`([a-zA-Z0-9]+:([^ "]+|"[^"]+"))|([^ "]+)|"([^"]+)"`)
-var rexp = regexp.MustCompile(`([a-zA-Z0-9]+:([^ "]+|"[^"]+"))`)
+// builtin fields of the query language, additional to [searchfields]
+var queryBuiltinFields = map[string]string{
+	"title":     "title",
+	"date":      "date",
+	"signature": "signature",
+}
+
+// queryFields maps the field names of the search box to the index fields
+func (s *Server) queryFields() map[string]string {
+	fields := map[string]string{}
+	for name, fld := range queryBuiltinFields {
+		fields[name] = fld
+	}
+	for name, fld := range s.searchFields {
+		// old style configuration "author:__Q__"
+		fld, _, _ = strings.Cut(fld, ":")
+		fields[name] = fld
+	}
+	return fields
+}
 
 func (s *Server) string2QList(search string, filterOrg map[string][]string) (map[string][]string, map[string][]string, string) {
-	slice := rexp.FindAllString(search, -1)
-	if slice == nil {
-		slice = []string{}
+	fldlistOrg, fldlist, qstr, err := s.parseSearchString(search, filterOrg)
+	if err != nil {
+		s.log.Info().Msgf("invalid query '%s': %v", search, err)
 	}
+	return fldlistOrg, fldlist, qstr
+}
 
-	// expand to field an generic search
-	rexp2 := regexp.MustCompile(`^(` + strings.Join(maps.GetKeysStringString(s.searchFields), `|`) + `):(.+)$`)
-	//Fields := make(map[string][]string)
-	gen := []string{}
+/*
+parseSearchString parses the search box. fields from [searchfields] on the top level of the query become filters,
+the rest is returned as query string for the search engine.
+on a syntax error the words of the search are used as query
+*/
+func (s *Server) parseSearchString(search string, filterOrg map[string][]string) (map[string][]string, map[string][]string, string, error) {
+	fields := s.queryFields()
 	fldlist := make(map[string][]string)
 	fldlistOrg := filterOrg
 	if fldlistOrg == nil {
 		fldlistOrg = make(map[string][]string)
 	}
-
-	for fld, val := range fldlistOrg {
-		fld, ok := s.searchFields[fld]
-		if !ok {
+	for name, val := range fldlistOrg {
+		if _, ok := s.searchFields[name]; !ok {
 			continue
 		}
-		fldlist[fld] = val
+		fldlist[fields[name]] = val
 	}
 
-	for _, f := range slice {
-		fldq := rexp2.FindStringSubmatch(f)
-		if fldq != nil {
-			fld, ok := s.searchFields[fldq[1]]
-			if !ok {
+	node, err := ParseQuery(search, fields)
+	if err != nil {
+		return fldlistOrg, fldlist, strings.Join(wordsRegexp.FindAllString(search, -1), " "), err
+	}
+	if node == nil {
+		return fldlistOrg, fldlist, "", nil
+	}
+
+	children := []QueryNode{node}
+	if bn, ok := node.(*QueryBoolNode); ok {
+		if bn.Op == QueryOperatorOR {
+			return fldlistOrg, fldlist, node.String(), nil
+		}
+		children = bn.Children
+	}
+	rest := []QueryNode{}
+	for _, child := range children {
+		term, ok := child.(*QueryTermNode)
+		if ok && term.Field != "" && !term.Wildcard {
+			if name := s.searchFieldName(term.Field); name != "" {
+				fldlist[term.Field] = append(fldlist[term.Field], term.Value)
+				fldlistOrg[name] = append(fldlistOrg[name], term.Value)
 				continue
 			}
-			val := fldq[2]
-			if _, ok := fldlist[fld]; !ok {
-				fldlist[fld] = []string{}
-				fldlistOrg[fldq[1]] = []string{}
-			}
-			fldlist[fld] = append(fldlist[fld], strings.Trim(val, `""''`))
-			fldlistOrg[fldq[1]] = append(fldlistOrg[fldq[1]], strings.Trim(val, `""''`))
-		} else {
-			gen = append(gen, f)
 		}
+		rest = append(rest, child)
 	}
-	return fldlistOrg, fldlist, strings.TrimSpace(rexp.ReplaceAllString(search, " "))
+	op := QueryOperatorDefault
+	if bn, ok := node.(*QueryBoolNode); ok {
+		op = bn.Op
+	}
+	qstr := ""
+	if len(rest) > 0 {
+		qstr = (&QueryBoolNode{Op: op, Children: rest}).String()
+	}
+	return fldlistOrg, fldlist, qstr, nil
+}
+
+// searchFieldName returns the [searchfields] name of an index field
+func (s *Server) searchFieldName(field string) string {
+	for name, fld := range s.searchFields {
+		if fld, _, _ = strings.Cut(fld, ":"); fld == field {
+			return name
+		}
+	}
+	return ""
 }
 
 func (s *Server) doc2result(
@@ -1255,6 +1362,16 @@ func (s *Server) doc2result(
 		}
 	}
 
+	for facet, tf := range facets {
+		if tf.Type != FacetTypeHierarchy {
+			continue
+		}
+		if result.FacetTree == nil {
+			result.FacetTree = map[string][]*FacetNode{}
+		}
+		result.FacetTree[facet] = FacetTree(facet, facetFieldCount[facet], tf.Selected)
+	}
+
 	for key, doc := range docs {
 		if doc == nil {
 			return nil, fmt.Errorf("empty document %v", key)
@@ -1334,8 +1451,8 @@ func (s *Server) doc2result(
 			item.ContentOK = true
 		}
 
-		if hl := highlight[key]; ok {
-			item.Highlight = hl
+		if key < len(highlight) {
+			item.Highlight = highlight[key]
 		}
 
 		result.Items = append(result.Items, item)
@@ -0,0 +1,188 @@
+/*
+Copyright 2020 Center for Digital Matter HGK FHNW, Basel.
+Copyright 2020 info-age GmbH, Basel.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS-IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ApiCacheStatsResult struct {
+	Version   string     `json:"version"`
+	Documents CacheStats `json:"documents"`
+	Results   CacheStats `json:"results"`
+}
+
+type ApiAnalyticsResult struct {
+	Version string `json:"version"`
+	*AnalyticsReport
+}
+
+// SetAnalytics enables the recording of searches and clicks
+func (s *Server) SetAnalytics(a *Analytics) {
+	s.analytics = a
+}
+
+/*
+recordSearch stores the first result page of a search, following pages and debug searches are ignored.
+total is -1 if the result comes from the cache
+*/
+func (s *Server) recordSearch(key [16]byte, cfg *SearchConfig, search string, facets map[string]TermFacet, ranges map[string]string, total int64) {
+	if s.analytics == nil || cfg.Start > 0 || cfg.Cursor != "" || cfg.Debug != nil {
+		return
+	}
+	filters := map[string][]string{}
+	for name, facet := range facets {
+		for val, selected := range facet.Selected {
+			if selected {
+				filters[name] = append(filters[name], val)
+			}
+		}
+	}
+	for name, val := range ranges {
+		filters["range_"+name] = []string{val}
+	}
+	if err := s.analytics.AddSearch(fmt.Sprintf("%x", key), &SearchEvent{
+		Time:    time.Now(),
+		Query:   search,
+		Filters: filters,
+		Mode:    string(cfg.Mode),
+		Total:   total,
+	}); err != nil {
+		s.log.Error().Msgf("cannot record search: %v", err)
+	}
+}
+
+// recordClick stores the opening of a detail page if the referer is the search page of this server
+func (s *Server) recordClick(req *http.Request, signature string) {
+	if s.analytics == nil {
+		return
+	}
+	referer, err := url.Parse(req.Referer())
+	if err != nil || referer.Host != s.addrExt.Host {
+		return
+	}
+	path := strings.Trim(strings.TrimPrefix(referer.Path, s.addrExt.Path), "/")
+	if path != s.prefixes["search"] && !strings.HasPrefix(path, s.prefixes["search"]+"/") {
+		return
+	}
+	if err := s.analytics.AddClick(&ClickEvent{
+		Time:      time.Now(),
+		Query:     referer.Query().Get("searchtext"),
+		Signature: signature,
+	}); err != nil {
+		s.log.Error().Msgf("cannot record click on %s: %v", signature, err)
+	}
+}
+
+/*
+apiHandlerAnalytics reports the top queries, zero result queries and click-through rates for administrators.
+the time window are the last days (default 30) or from and to (2006-01-02, to inclusive), limit restricts the lists (default 50)
+*/
+func (s *Server) apiHandlerAnalytics(w http.ResponseWriter, req *http.Request) {
+	user := s.userFromRequest(req)
+	if !user.inGroup(s.adminGroup) {
+		s.apiErrorf(w, http.StatusForbidden, "analytics are only allowed for administrators")
+		return
+	}
+	if s.analytics == nil {
+		s.apiErrorf(w, http.StatusNotFound, "analytics not enabled")
+		return
+	}
+
+	query := req.URL.Query()
+	limit := 50
+	if l := query.Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit <= 0 {
+			s.apiErrorf(w, http.StatusBadRequest, "invalid limit %v", l)
+			return
+		}
+	}
+	to := time.Now()
+	days := 30
+	if d := query.Get("days"); d != "" {
+		var err error
+		days, err = strconv.Atoi(d)
+		if err != nil || days <= 0 {
+			s.apiErrorf(w, http.StatusBadRequest, "invalid number of days %v", d)
+			return
+		}
+	}
+	from := to.AddDate(0, 0, -days)
+	if f := query.Get("from"); f != "" {
+		var err error
+		from, err = time.ParseInLocation("2006-01-02", f, time.Local)
+		if err != nil {
+			s.apiErrorf(w, http.StatusBadRequest, "invalid date from=%s: %v", f, err)
+			return
+		}
+	}
+	if t := query.Get("to"); t != "" {
+		day, err := time.ParseInLocation("2006-01-02", t, time.Local)
+		if err != nil {
+			s.apiErrorf(w, http.StatusBadRequest, "invalid date to=%s: %v", t, err)
+			return
+		}
+		to = day.AddDate(0, 0, 1)
+	}
+	if !from.Before(to) {
+		s.apiErrorf(w, http.StatusBadRequest, "empty time window %s - %s", from, to)
+		return
+	}
+
+	report, err := s.analytics.Report(from, to, limit)
+	if err != nil {
+		s.apiErrorf(w, http.StatusInternalServerError, "cannot create report: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "private, no-store")
+	j := json.NewEncoder(w)
+	if err := j.Encode(ApiAnalyticsResult{
+		Version:         QueryApiVersion,
+		AnalyticsReport: report,
+	}); err != nil {
+		s.log.Error().Msgf("cannot encode analytics report: %v", err)
+	}
+}
+
+// apiHandlerCacheStats reports the counters of the document cache and the result cache for administrators
+func (s *Server) apiHandlerCacheStats(w http.ResponseWriter, req *http.Request) {
+	user := s.userFromRequest(req)
+	if !user.inGroup(s.adminGroup) {
+		s.apiErrorf(w, http.StatusForbidden, "cache statistics are only allowed for administrators")
+		return
+	}
+	documents, results := s.mts.CacheStats()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "private, no-store")
+	j := json.NewEncoder(w)
+	if err := j.Encode(ApiCacheStatsResult{
+		Version:   QueryApiVersion,
+		Documents: documents,
+		Results:   results,
+	}); err != nil {
+		s.log.Error().Msgf("cannot encode cache statistics: %v", err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/gorilla/mux"
 	"io"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -82,6 +83,9 @@ func (s *Server) apiHandlerSignatureCreate(w http.ResponseWriter, req *http.Requ
 		}
 		return
 	}
+	if err := s.mts.InvalidateCache(data.Signature); err != nil {
+		s.log.Error().Msgf("cannot invalidate cache of %s: %v", data.Signature, err)
+	}
 	j := json.NewEncoder(w)
 	w.WriteHeader(http.StatusCreated)
 	if err := j.Encode(ApiResult{
@@ -124,12 +128,12 @@ func (s *Server) apiHandlerSignaturesDelete(w http.ResponseWriter, req *http.Req
 		ContentVisible: false,
 		IsAdmin:        true,
 	}
-	num, err := s.mts.se.Delete(cfg)
+	num, err := s.mts.DeleteContext(req.Context(), cfg)
 	if err != nil {
 		msg := fmt.Sprintf("error deleting signatures %s: %v", prefix, err)
 		s.log.Info().Msgf("error in apiHandlerSignaturesDelete: %s", msg)
 		j := json.NewEncoder(w)
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(searchErrorStatus(w, err))
 		if err := j.Encode(ApiResult{
 			Status:  "error",
 			Message: msg,
@@ -139,6 +143,9 @@ func (s *Server) apiHandlerSignaturesDelete(w http.ResponseWriter, req *http.Req
 		}
 		return
 	}
+	if err := s.mts.InvalidateCachePrefix(prefix); err != nil {
+		s.log.Error().Msgf("cannot invalidate cache of %s: %v", prefix, err)
+	}
 	msg := fmt.Sprintf("%v signatures with prefix %s deleted", num, prefix)
 	s.log.Info().Msgf("apiHandlerSignaturesDelete: %s", msg)
 	j := json.NewEncoder(w)
@@ -181,12 +188,12 @@ func (s *Server) apiHandlerLastUpdate(w http.ResponseWriter, req *http.Request)
 		ContentVisible: false,
 		IsAdmin:        true,
 	}
-	last, err := s.mts.se.LastUpdate(cfg)
+	last, err := s.mts.LastUpdateContext(req.Context(), cfg)
 	if err != nil {
 		msg := fmt.Sprintf("error getting last update %s: %v", prefix, err)
 		s.log.Info().Msgf("error in apiHandlerLastUpdate: %s", msg)
 		j := json.NewEncoder(w)
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(searchErrorStatus(w, err))
 		if err := j.Encode(ApiResult{
 			Status:  "error",
 			Message: msg,
@@ -237,12 +244,54 @@ func (s *Server) apiHandlerClearCache(w http.ResponseWriter, req *http.Request)
 
 }
 
+/*
+apiHandlerInvalidateCache removes the documents with signatures starting with prefix from the cache.
+with exact=true only the document with the signature prefix is removed
+*/
+func (s *Server) apiHandlerInvalidateCache(w http.ResponseWriter, req *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+
+	vars := mux.Vars(req)
+	prefix := vars["prefix"]
+	var err error
+	var msg string
+	if exact, _ := strconv.ParseBool(req.URL.Query().Get("exact")); exact {
+		err = s.mts.InvalidateCache(prefix)
+		msg = fmt.Sprintf("cache of %s invalidated", prefix)
+	} else {
+		err = s.mts.InvalidateCachePrefix(prefix)
+		msg = fmt.Sprintf("cache of %s* invalidated", prefix)
+	}
+	if err != nil {
+		msg := fmt.Sprintf("cannot invalidate cache of %s: %v", prefix, err)
+		s.log.Error().Msgf(msg)
+		j := json.NewEncoder(w)
+		w.WriteHeader(http.StatusInternalServerError)
+		if err := j.Encode(ApiResult{
+			Status:  "error",
+			Message: msg,
+			Result:  nil,
+		}); err != nil {
+			s.log.Error().Msgf("cannot return error message: %v", err)
+		}
+		return
+	}
+	j := json.NewEncoder(w)
+	if err := j.Encode(ApiResult{
+		Status:  "ok",
+		Message: msg,
+		Result:  nil,
+	}); err != nil {
+		s.log.Error().Msgf("cannot return error message: %v", err)
+	}
+}
+
 var sitemapMutex sync.Mutex
 
 func (s *Server) apiHandlerBuildSitemap(w http.ResponseWriter, req *http.Request) {
 	sitemapMutex.Lock()
 	defer sitemapMutex.Unlock()
-	if err := s.buildSitemap(); err != nil {
+	if err := s.buildSitemap(req.Context()); err != nil {
 		msg := "error building sitemap"
 		s.log.Info().Msgf("error in apiHandlerBuildSitemap: %s", msg)
 		j := json.NewEncoder(w)
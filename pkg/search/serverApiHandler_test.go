@@ -0,0 +1,43 @@
+package search
+
+import (
+	"github.com/rs/zerolog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// documents of the api get the normalized date of the indexer
+func TestApiSignatureCreate(t *testing.T) {
+	mbs := newTestBleveSearch(t)
+	logger := zerolog.Nop()
+	mts, err := NewSearch(mbs, NewNoopCache(), &logger)
+	if err != nil {
+		t.Fatalf("cannot create search: %v", err)
+	}
+	s := &Server{mts: mts, log: &logger}
+	body := `{"signature":"api-1","source":"test","date":"1987","acl":{"meta":["global/guest"]},"catalog":["test"]}`
+	w := httptest.NewRecorder()
+	s.apiHandlerSignatureCreate(w, httptest.NewRequest(http.MethodPost, "/api/signatures", strings.NewReader(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("cannot create api-1: %d %s", w.Code, w.Body.String())
+	}
+
+	filters, err := RangeFilters(DateFacets(time.Now()), map[string]string{DateFacetDecade: "1980"})
+	if err != nil {
+		t.Fatalf("cannot create range filters: %v", err)
+	}
+	_, docs, total, _, _, err := mbs.Search(&SearchConfig{
+		Groups:       []string{"global/guest"},
+		RangeFilters: filters,
+		Rows:         10,
+	})
+	if err != nil {
+		t.Fatalf("cannot search: %v", err)
+	}
+	if total != 1 || docs[0].Signature != "api-1" || docs[0].ItemDate == nil {
+		t.Errorf("api-1 not found by its decade: %v hits", total)
+	}
+}
@@ -132,9 +132,9 @@ func (s *Server) clusterAllHandler(w http.ResponseWriter, req *http.Request) {
 		Rows:           int(1000),
 		IsAdmin:        status.User.inGroup(s.adminGroup),
 	}
-	_, docs, total, _, err := s.mts.Search(cfg)
+	_, docs, total, _, _, err := s.mts.SearchContext(req.Context(), cfg)
 	if err != nil {
-		s.DoPanicf(nil, req, w, http.StatusInternalServerError, "cannot execute solr query: %v", false, err)
+		s.DoPanicf(nil, req, w, searchErrorStatus(w, err), "cannot execute solr query: %v", false, err)
 		return
 	}
 
@@ -17,6 +17,7 @@ limitations under the License.
 package search
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/gorilla/mux"
@@ -28,6 +29,9 @@ import (
 	"time"
 )
 
+// number of related items on the detail page
+const relatedRows = 6
+
 type ErrorHTTPStatus struct {
 	status int
 	err    error
@@ -37,7 +41,44 @@ func (err *ErrorHTTPStatus) Error() string {
 	return fmt.Sprintf("%s - %s", http.StatusText(err.status), err.err.Error())
 }
 
-func (s *Server) getDetailStatus(signature, path, rawQuery, tokenstring, remoteHost string) (*DetailStatus, error) {
+/*
+docAccess evaluates the acl of doc for the groups of a user.
+public means visible for guests, administrators see everything
+*/
+func (s *Server) docAccess(doc *SourceData, groups []string) (metaOK, contentOK, metaPublic, contentPublic bool) {
+	for acl, aclGroups := range doc.ACL {
+		for _, group := range aclGroups {
+			for _, ugroup := range groups {
+				if group == ugroup {
+					switch acl {
+					case "meta":
+						metaOK = true
+					case "content":
+						contentOK = true
+					}
+				}
+			}
+			if group == s.guestGroup {
+				switch acl {
+				case "meta":
+					metaPublic = true
+				case "content":
+					contentPublic = true
+				}
+			}
+		}
+	}
+
+	for _, ugroup := range groups {
+		if s.adminGroup == ugroup {
+			metaOK = true
+			contentOK = true
+		}
+	}
+	return
+}
+
+func (s *Server) getDetailStatus(ctx context.Context, signature, path, rawQuery, tokenstring, remoteHost string) (*DetailStatus, error) {
 	status := DetailStatus{
 		BaseStatus: BaseStatus{
 			Type:          "detail",
@@ -91,8 +132,12 @@ func (s *Server) getDetailStatus(signature, path, rawQuery, tokenstring, remoteH
 		status.User.Groups = append(status.User.Groups, grp)
 	}
 
-	doc, err := s.mts.LoadEntity(signature)
+	doc, err := s.mts.LoadEntity(ctx, signature)
 	if err != nil {
+		// timeouts and unavailable search engines are no missing documents
+		if errors.Is(err, ErrUnavailable) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return nil, err
+		}
 		return nil, &ErrorHTTPStatus{
 			status: http.StatusNotFound,
 			err:    errors.Wrapf(err, "we could not find signature #%s", signature),
@@ -113,42 +158,14 @@ func (s *Server) getDetailStatus(signature, path, rawQuery, tokenstring, remoteH
 		}
 	}
 
-	for acl, groups := range status.Doc.ACL {
-		for _, group := range groups {
-			for _, ugroup := range status.User.Groups {
-				if group == ugroup {
-					switch acl {
-					case "meta":
-						status.MetaOK = true
-					case "content":
-						status.ContentOK = true
-					}
-				}
-			}
-			if group == s.guestGroup {
-				switch acl {
-				case "meta":
-					status.MetaPublic = true
-				case "content":
-					status.ContentPublic = true
-				}
-			}
-		}
-	}
-
-	for _, ugroup := range status.User.Groups {
-		if s.adminGroup == ugroup {
-			status.MetaOK = true
-			status.ContentOK = true
-		}
-	}
+	status.MetaOK, status.ContentOK, status.MetaPublic, status.ContentPublic = s.docAccess(status.Doc, status.User.Groups)
 
 	// load all references
 	// title only if rights ok
 	removeRefs := []int{}
 	for key, ref := range status.Doc.References {
 		if ref.Title == "" {
-			doc, err := s.mts.LoadEntity(ref.Signature)
+			doc, err := s.mts.LoadEntity(ctx, ref.Signature)
 			if err != nil {
 				removeRefs = append(removeRefs, key)
 			} else if doc != nil {
@@ -210,6 +227,26 @@ func (s *Server) getDetailStatus(signature, path, rawQuery, tokenstring, remoteH
 		status.MetaDescription = status.MetaDescription[0:155] + "..."
 	}
 
+	// related items, so that visitors from search engines can continue browsing
+	if status.MetaOK {
+		filterField := map[string][]string{}
+		s.addBaseCatalog(filterField)
+		related, err := s.mts.Related(ctx, doc, &SearchConfig{
+			FiltersFields: filterField,
+			Groups:        status.User.Groups,
+			Rows:          relatedRows,
+			IsAdmin:       status.User.inGroup(s.adminGroup),
+		})
+		if err != nil {
+			s.log.Warn().Msgf("cannot load related items of %s: %v", signature, err)
+		} else {
+			status.Related, err = s.doc2result("", "", related, int64(len(related)), nil, map[string]TermFacet{}, 0, &status.BaseStatus, "", nil)
+			if err != nil {
+				return nil, errors.Wrap(err, "cannot marshal related items")
+			}
+		}
+	}
+
 	if len(status.Doc.Queries) > 0 {
 		_, filterField, qstr := s.string2QList(status.Doc.Queries[0].Search, map[string][]string{})
 
@@ -226,7 +263,7 @@ func (s *Server) getDetailStatus(signature, path, rawQuery, tokenstring, remoteH
 			IsAdmin:        status.User.inGroup(s.adminGroup),
 		}
 
-		highlights, docs, total, facetFieldCount, err := s.mts.Search(cfg)
+		highlights, docs, total, facetFieldCount, _, err := s.mts.SearchContext(ctx, cfg)
 		if err != nil {
 			return nil, errors.Wrap(err, "cannot execute solr query")
 		}
@@ -271,12 +308,12 @@ func (s *Server) detailEmbedHandler(w http.ResponseWriter, req *http.Request) {
 	}
 
 	remoteHost, _, _ := net.SplitHostPort(req.Host)
-	status, err := s.getDetailStatus(signature, req.URL.Path, req.URL.RawQuery, tokenstring, remoteHost)
+	status, err := s.getDetailStatus(req.Context(), signature, req.URL.Path, req.URL.RawQuery, tokenstring, remoteHost)
 	if err != nil {
 		if ehs, ok := err.(*ErrorHTTPStatus); ok {
 			s.DoPanicf(nil, req, w, ehs.status, ehs.err.Error(), false)
 		} else {
-			s.DoPanicf(nil, req, w, http.StatusInternalServerError, err.Error(), false)
+			s.DoPanicf(nil, req, w, searchErrorStatus(w, err), err.Error(), false)
 		}
 		return
 	}
@@ -373,12 +410,12 @@ func (s *Server) detailHandler(w http.ResponseWriter, req *http.Request) {
 	}
 
 	remoteHost, _, _ := net.SplitHostPort(req.Host)
-	status, err := s.getDetailStatus(signature, req.URL.Path, req.URL.RawQuery, tokenstring, remoteHost)
+	status, err := s.getDetailStatus(req.Context(), signature, req.URL.Path, req.URL.RawQuery, tokenstring, remoteHost)
 	if err != nil {
 		if ehs, ok := err.(*ErrorHTTPStatus); ok {
 			s.DoPanicf(nil, req, w, ehs.status, ehs.err.Error(), false)
 		} else {
-			s.DoPanicf(nil, req, w, http.StatusInternalServerError, err.Error(), false)
+			s.DoPanicf(nil, req, w, searchErrorStatus(w, err), err.Error(), false)
 		}
 		return
 	}
@@ -410,6 +447,7 @@ func (s *Server) detailHandler(w http.ResponseWriter, req *http.Request) {
 		}
 		return
 	}
+	s.recordClick(req, signature)
 
 	if data {
 		w.Header().Set("Content-type", "text/json")
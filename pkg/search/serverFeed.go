@@ -0,0 +1,255 @@
+/*
+Copyright 2020 Center for Digital Matter HGK FHNW, Basel.
+Copyright 2020 info-age GmbH, Basel.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS-IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package search
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/je4/zsearch/v2/pkg/translate"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	FeedAtom = "atom"
+	FeedRSS  = "rss"
+)
+
+// maximum number of feed entries
+const feedMaxRows = 100
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Title   string       `xml:"title"`
+	Id      string       `xml:"id"`
+	Updated string       `xml:"updated"`
+	Links   []atomLink   `xml:"link"`
+	Authors []atomPerson `xml:"author,omitempty"`
+	Summary string       `xml:"summary,omitempty"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	Id      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssGuid struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+type rssEnclosure struct {
+	Url    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	Description string        `xml:"description,omitempty"`
+	Author      []string      `xml:"http://purl.org/dc/elements/1.1/ creator,omitempty"`
+	Guid        rssGuid       `xml:"guid"`
+	PubDate     string        `xml:"pubDate"`
+	Enclosure   *rssEnclosure `xml:"enclosure,omitempty"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+// feedValues are the query parameters of a search without the paging, the debug output and the token of the user
+func feedValues(req *http.Request) url.Values {
+	values := req.URL.Query()
+	for _, param := range []string{"start", "cursor", "lastsearch", "debug", "token", "sort", "feed"} {
+		values.Del(param)
+	}
+	return values
+}
+
+// feedLinks returns the atom and rss urls of the current search
+func (s *Server) feedLinks(req *http.Request) (template.URL, template.URL) {
+	values := feedValues(req)
+	base := fmt.Sprintf("%s/%s", s.addrExt, strings.TrimLeft(req.URL.Path, "/"))
+	values.Set("feed", FeedAtom)
+	atom := template.URL(fmt.Sprintf("%s?%s", base, values.Encode()))
+	values.Set("feed", FeedRSS)
+	rss := template.URL(fmt.Sprintf("%s?%s", base, values.Encode()))
+	return atom, rss
+}
+
+func feedText(m *translate.MultiLangString) string {
+	if m == nil {
+		return ""
+	}
+	return m.String()
+}
+
+/*
+feedHandler writes the newest documents of the search cfg as atom or rss feed.
+feeds are public: only documents with guest access are included, whoever requested the feed
+*/
+func (s *Server) feedHandler(w http.ResponseWriter, req *http.Request, format string, title string, cfg *SearchConfig) {
+	if format != FeedAtom && format != FeedRSS {
+		s.DoPanicf(nil, req, w, http.StatusBadRequest, "unknown feed format %s (%s, %s)", false, format, FeedAtom, FeedRSS)
+		return
+	}
+	cfg.Groups = []string{s.guestGroup}
+	cfg.IsAdmin = false
+	cfg.Start = 0
+	cfg.Cursor = ""
+	cfg.Mode = SearchModeLexical
+	cfg.Sort = SortOrder{Field: SortDateAdded, Order: SortDesc}
+	cfg.Debug = nil
+	if cfg.Rows <= 0 || cfg.Rows > feedMaxRows {
+		cfg.Rows = feedMaxRows
+	}
+	_, docs, _, _, _, err := s.mts.SearchContext(req.Context(), cfg)
+	if err != nil {
+		s.DoPanicf(nil, req, w, searchErrorStatus(w, err), "cannot execute query: %v", false, err)
+		return
+	}
+
+	values := feedValues(req)
+	htmlLink := fmt.Sprintf("%s/%s", s.addrExt, strings.TrimLeft(req.URL.Path, "/"))
+	if len(values) > 0 {
+		htmlLink += "?" + values.Encode()
+	}
+	values.Set("feed", format)
+	selfLink := fmt.Sprintf("%s/%s?%s", s.addrExt, strings.TrimLeft(req.URL.Path, "/"), values.Encode())
+	feedTitle := s.instanceName
+	if title != "" {
+		feedTitle += " - " + title
+	}
+	if cfg.QStr != "" {
+		feedTitle += ": " + cfg.QStr
+	}
+	updated := time.Time{}
+	for _, doc := range docs {
+		if doc.DateAdded.After(updated) {
+			updated = doc.DateAdded
+		}
+	}
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+
+	var data interface{}
+	var contentType string
+	switch format {
+	case FeedAtom:
+		feed := &atomFeed{
+			Title:   feedTitle,
+			Id:      selfLink,
+			Updated: updated.UTC().Format(time.RFC3339),
+			Links: []atomLink{
+				{Href: selfLink, Rel: "self", Type: "application/atom+xml"},
+				{Href: htmlLink, Rel: "alternate", Type: "text/html"},
+			},
+			Entries: []atomEntry{},
+		}
+		for _, doc := range docs {
+			link := fmt.Sprintf("%s/%s/%s", s.addrExt, s.prefixes["detail"], doc.Signature)
+			entry := atomEntry{
+				Title:   feedText(doc.Title),
+				Id:      link,
+				Updated: doc.DateAdded.UTC().Format(time.RFC3339),
+				Links:   []atomLink{{Href: link, Rel: "alternate", Type: "text/html"}},
+				Summary: feedText(doc.Abstract),
+			}
+			for _, p := range doc.Persons {
+				entry.Authors = append(entry.Authors, atomPerson{Name: p.Name})
+			}
+			if doc.Poster != nil {
+				if imgUrl, err := s.mediaserverUri2Url(doc.Poster.Uri, "resize", "size640x480", "formatJPEG"); err == nil {
+					entry.Links = append(entry.Links, atomLink{Href: imgUrl, Rel: "enclosure", Type: "image/jpeg"})
+				}
+			}
+			feed.Entries = append(feed.Entries, entry)
+		}
+		data = feed
+		contentType = "application/atom+xml; charset=utf-8"
+	case FeedRSS:
+		feed := &rssFeed{
+			Version: "2.0",
+			Channel: rssChannel{
+				Title:         feedTitle,
+				Link:          htmlLink,
+				Description:   feedTitle,
+				LastBuildDate: updated.Format(time.RFC1123Z),
+				Items:         []rssItem{},
+			},
+		}
+		for _, doc := range docs {
+			link := fmt.Sprintf("%s/%s/%s", s.addrExt, s.prefixes["detail"], doc.Signature)
+			item := rssItem{
+				Title:       feedText(doc.Title),
+				Link:        link,
+				Description: feedText(doc.Abstract),
+				Guid:        rssGuid{Value: link, IsPermaLink: true},
+				PubDate:     doc.DateAdded.Format(time.RFC1123Z),
+			}
+			for _, p := range doc.Persons {
+				item.Author = append(item.Author, p.Name)
+			}
+			if doc.Poster != nil {
+				if imgUrl, err := s.mediaserverUri2Url(doc.Poster.Uri, "resize", "size640x480", "formatJPEG"); err == nil {
+					item.Enclosure = &rssEnclosure{Url: imgUrl, Type: "image/jpeg"}
+				}
+			}
+			feed.Channel.Items = append(feed.Channel.Items, item)
+		}
+		data = feed
+		contentType = "application/rss+xml; charset=utf-8"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "max-age=3600, public")
+	io.WriteString(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(data); err != nil {
+		s.log.Error().Msgf("cannot encode %s feed: %v", format, err)
+	}
+}
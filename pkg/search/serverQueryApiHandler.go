@@ -0,0 +1,324 @@
+/*
+Copyright 2020 Center for Digital Matter HGK FHNW, Basel.
+Copyright 2020 info-age GmbH, Basel.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS-IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const QueryApiVersion = "v1"
+
+type ApiSearchResult struct {
+	Version string       `json:"version"`
+	Debug   *SearchDebug `json:"debug,omitempty"`
+	*SearchResult
+}
+
+func (s *Server) apiErrorf(w http.ResponseWriter, status int, format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+	s.log.Error().Msg(msg)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	j := json.NewEncoder(w)
+	if err := j.Encode(ApiResult{
+		Status:  "error",
+		Message: msg,
+		Result:  nil,
+	}); err != nil {
+		s.log.Error().Msgf("cannot return error message: %v", err)
+	}
+}
+
+/*
+userFromRequest resolves the user like searchHandler does: token parameter, bearer token or session cookie.
+invalid or missing tokens result in a guest user. location groups are added
+*/
+func (s *Server) userFromRequest(req *http.Request) *User {
+	var tokenstring string
+	if token := req.URL.Query().Get("token"); token != "" {
+		tokenstring = token
+	} else if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		tokenstring = strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	} else if sess, err := s.cookieStore.Get(req, "logged-in"); err == nil {
+		if sessJWT, ok := sess.Values["user"]; ok {
+			tokenstring, _ = sessJWT.(string)
+		}
+	}
+	var user *User
+	if tokenstring != "" {
+		var err error
+		user, err = s.userFromToken(tokenstring, "")
+		if err != nil {
+			s.log.Info().Msgf("invalid token - using guest: %v", err)
+			user = nil
+		}
+	}
+	if user == nil {
+		user = NewGuestUser(s)
+	}
+	// do not modify the cached user
+	u := *user
+	u.Groups = append(append([]string{}, user.Groups...), s.locationGroups(req)...)
+	return &u
+}
+
+/*
+apiHandlerSearch is the machine readable counterpart of searchHandler.
+it takes the same parameters (searchtext, start, rows, facet_<field>_<n>, filter_<n>_<field>, range_<facet>, visible, mode, cursor, sort, lang, debug).
+the cursor from next continues with the following page, also beyond the 10000 hits of from/size.
+debug=true adds the queries, scores and explanations of the search engine and is only allowed for administrators
+*/
+func (s *Server) apiHandlerSearch(w http.ResponseWriter, req *http.Request) {
+	user := s.userFromRequest(req)
+
+	facets, _ := s.defaultFacets()
+	sp := parseSearchParams(req.URL.Query(), facets)
+	if sp.rows <= 0 || sp.rows > 100 {
+		s.apiErrorf(w, http.StatusBadRequest, "invalid number of rows %v (1-100)", sp.rows)
+		return
+	}
+	mode, ok := ParseSearchMode(sp.mode)
+	if !ok || !slices.Contains(s.mts.SearchModes(), mode) {
+		s.apiErrorf(w, http.StatusBadRequest, "search mode %s not available", sp.mode)
+		return
+	}
+	sortOrder, err := ParseSortOrder(sp.sort)
+	if err != nil {
+		s.apiErrorf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	// ranking and title sort depend on the query language
+	if sp.lang == "" {
+		w.Header().Add("Vary", "Accept-Language")
+	}
+	_, filterField, qstr, err := s.parseSearchString(sp.search, sp.filterOrg)
+	if err != nil {
+		s.apiErrorf(w, http.StatusBadRequest, "invalid query: %v", err)
+		return
+	}
+	// semantic and hybrid hits are ranked by similarity
+	if rankedBySimilarity(mode, qstr) && !sortOrder.IsRelevance() {
+		s.apiErrorf(w, http.StatusBadRequest, "sort %s not available in search mode %s", sortOrder, mode)
+		return
+	}
+	s.addBaseCatalog(filterField)
+	dateFacets := DateFacets(time.Now())
+	rangeFilters, err := RangeFilters(dateFacets, sp.ranges)
+	if err != nil {
+		s.apiErrorf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	cfg := &SearchConfig{
+		Fields:         make(map[string][]string),
+		QStr:           qstr,
+		FiltersFields:  filterField,
+		Facets:         facets,
+		Groups:         user.Groups,
+		ContentVisible: sp.visible,
+		Start:          int(sp.start),
+		Rows:           int(sp.rows),
+		IsAdmin:        user.inGroup(s.adminGroup),
+		Mode:           mode,
+		RangeFacets:    dateFacets,
+		RangeFilters:   rangeFilters,
+		Cursor:         sp.cursor,
+		Sort:           sortOrder,
+		Lang:           MatchLanguage(sp.lang, req.Header.Get("Accept-Language")),
+	}
+	if sp.debug {
+		if !cfg.IsAdmin {
+			s.apiErrorf(w, http.StatusForbidden, "debug is only allowed for administrators")
+			return
+		}
+		cfg.Debug = &SearchDebug{}
+	}
+	start := sp.start
+	if cfg.Cursor != "" {
+		cursor, err := parseSearchCursor(cfg)
+		if err != nil {
+			s.apiErrorf(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		start = int64(cursor.Offset)
+	}
+	searchBegin := time.Now()
+	highlights, docs, total, facetFieldCount, next, err := s.mts.SearchContext(req.Context(), cfg)
+	if err != nil {
+		s.apiErrorf(w, searchErrorStatus(w, err), "cannot execute query: %v", err)
+		return
+	}
+	if cfg.Debug != nil {
+		cfg.Debug.Duration = time.Since(searchBegin).Milliseconds()
+	}
+
+	bs := &BaseStatus{
+		User:     user,
+		BaseUrl:  s.addrExt.String(),
+		SelfPath: req.URL.Path,
+		// partner sites need absolute links
+		RelPath: s.addrExt.String(),
+		Prefixes: map[string]string{
+			"detail":      s.prefixes["detail"],
+			"search":      s.prefixes["search"],
+			"collections": s.prefixes["collections"],
+			"cluster":     s.prefixes["cluster"],
+			"google":      s.prefixes["cse"],
+		},
+		server: s,
+	}
+	result, err := s.doc2result(sp.search, qstr, docs, total, facetFieldCount, facets, start, bs, next, highlights)
+	if err != nil {
+		s.apiErrorf(w, http.StatusInternalServerError, "cannot create result: %v", err)
+		return
+	}
+	result.DateFacetCount = dateFacetCount(dateFacets, facetFieldCount)
+	result.TotalEstimated = cfg.TotalEstimated()
+
+	w.Header().Set("Content-Type", "application/json")
+	// results of users and location groups must not end up in shared caches
+	if user.LoggedIn || len(s.locationGroups(req)) > 0 || cfg.Debug != nil {
+		w.Header().Set("Cache-Control", "private, no-store")
+	} else {
+		w.Header().Set("Cache-Control", "max-age=3600, public")
+	}
+	j := json.NewEncoder(w)
+	if err := j.Encode(ApiSearchResult{
+		Version:      QueryApiVersion,
+		Debug:        cfg.Debug,
+		SearchResult: result,
+	}); err != nil {
+		s.log.Error().Msgf("cannot encode search result: %v", err)
+	}
+}
+
+type ApiSignatureResult struct {
+	Version string `json:"version"`
+	// false if the content (media, fulltext) is removed because of insufficient rights
+	ContentOK bool        `json:"contentok"`
+	Doc       *SourceData `json:"doc"`
+}
+
+/*
+apiHandlerSignature returns the document with the signature as json.
+403 if the user may not see the metadata, without acl.content rights the media and fulltexts are removed
+*/
+func (s *Server) apiHandlerSignature(w http.ResponseWriter, req *http.Request) {
+	signature := mux.Vars(req)["signature"]
+	docs, err := s.mts.LoadEntities(req.Context(), []string{signature})
+	if err != nil {
+		status := searchErrorStatus(w, err)
+		s.apiErrorf(w, status, "cannot load signature %s: %v", signature, err)
+		return
+	}
+	doc, ok := docs[signature]
+	if !ok || doc == nil {
+		s.apiErrorf(w, http.StatusNotFound, "signature %s not found", signature)
+		return
+	}
+
+	user := s.userFromRequest(req)
+	metaOK, contentOK, metaPublic, contentPublic := s.docAccess(doc, user.Groups)
+	if !metaOK {
+		s.apiErrorf(w, http.StatusForbidden, "no access to signature %s", signature)
+		return
+	}
+	// the document is shared with the cache
+	result := *doc
+	if !contentOK {
+		result.Media = map[string]MediaList{}
+		result.ContentStr = ""
+		result.ContentMime = ""
+		result.ContentVector = nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	// the same response as for guests
+	if metaPublic && contentOK == contentPublic {
+		w.Header().Set("Cache-Control", "max-age=3600, public")
+	} else {
+		w.Header().Set("Cache-Control", "private, no-store")
+	}
+	j := json.NewEncoder(w)
+	if err := j.Encode(ApiSignatureResult{
+		Version:   QueryApiVersion,
+		ContentOK: contentOK,
+		Doc:       &result,
+	}); err != nil {
+		s.log.Error().Msgf("cannot encode signature %s: %v", signature, err)
+	}
+}
+
+type ApiSuggestResult struct {
+	Version     string       `json:"version"`
+	Query       string       `json:"query"`
+	Suggestions []Suggestion `json:"suggestions"`
+}
+
+/*
+apiHandlerSuggest completes the typed text (q) for a search box.
+the suggestions come from the documents the caller may see, rows limits the number (default 10)
+*/
+func (s *Server) apiHandlerSuggest(w http.ResponseWriter, req *http.Request) {
+	user := s.userFromRequest(req)
+
+	text := strings.TrimSpace(req.URL.Query().Get("q"))
+	rows := 10
+	if r := req.URL.Query().Get("rows"); r != "" {
+		var err error
+		rows, err = strconv.Atoi(r)
+		if err != nil || rows <= 0 || rows > 50 {
+			s.apiErrorf(w, http.StatusBadRequest, "invalid number of rows %v (1-50)", r)
+			return
+		}
+	}
+	filterField := map[string][]string{}
+	s.addBaseCatalog(filterField)
+	suggestions, err := s.mts.Suggest(req.Context(), &SearchConfig{
+		QStr:          text,
+		FiltersFields: filterField,
+		Groups:        user.Groups,
+		Rows:          rows,
+		IsAdmin:       user.inGroup(s.adminGroup),
+	})
+	if err != nil {
+		s.apiErrorf(w, searchErrorStatus(w, err), "cannot get suggestions: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if user.LoggedIn || len(s.locationGroups(req)) > 0 {
+		w.Header().Set("Cache-Control", "private, no-store")
+	} else {
+		w.Header().Set("Cache-Control", "max-age=3600, public")
+	}
+	j := json.NewEncoder(w)
+	if err := j.Encode(ApiSuggestResult{
+		Version:     QueryApiVersion,
+		Query:       text,
+		Suggestions: suggestions,
+	}); err != nil {
+		s.log.Error().Msgf("cannot encode suggestions: %v", err)
+	}
+}
@@ -28,14 +28,17 @@ import (
 	"net/http"
 	"net/url"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var facetDefRegexp = regexp.MustCompile("^([^:]+):(.+:)?([0-9-]+)$")
 var facetValRegexp = regexp.MustCompile("^(.+)\\.(true|false)$")
 var facetRegexp = regexp.MustCompile("^facet_([^_]+)_(.+)$")
 var filterRegexp = regexp.MustCompile("^filter_[0-9]+_(.+)$")
+var rangeRegexp = regexp.MustCompile("^range_(.+)$")
 
 func (s *Server) searchHandler(w http.ResponseWriter, req *http.Request) {
 	var facetCounter int64 = 1000
@@ -85,6 +88,8 @@ func (s *Server) searchHandler(w http.ResponseWriter, req *http.Request) {
 		},
 		QueryApi:        "api/search",
 		Facet:           make(map[string]map[string]FacetCountField),
+		FacetTree:       make(map[string][]*FacetNode),
+		DateFacet:       make(map[string][]FacetCountField),
 		CoreFacets:      []string{},
 		Filter:          make(map[string][]string),
 		Stats:           FacetCountResult{},
@@ -183,89 +188,73 @@ func (s *Server) searchHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	ip, _, _ := net.SplitHostPort(req.RemoteAddr)
-	for _, grp := range s.locations.Contains(ip) {
-		status.User.Groups = append(status.User.Groups, grp)
-	}
+	status.User.Groups = append(status.User.Groups, s.locationGroups(req)...)
 
-	facets := map[string]TermFacet{}
-	for _, val := range s.facets {
-		if _, ok := facets[val.Field]; !ok {
-			facets[val.Field] = TermFacet{
-				Selected: map[string]bool{},
-				Prefix:   "",
-				Limit:    0,
-			}
-		}
-		for v, sel := range val.Restrict {
-			facets[val.Field].Selected[v] = sel
-		}
-		status.CoreFacets = append(status.CoreFacets, val.Field)
-	}
+	facets, coreFacets := s.defaultFacets()
+	status.CoreFacets = append(status.CoreFacets, coreFacets...)
 
-	var start int64 = 0
-	var rows int64 = 10
-	var search, lastsearch string
-	var filterOrg = make(map[string][]string)
-
-	for key, vals := range req.URL.Query() {
-		if len(vals) == 0 {
-			continue
-		}
-		val := vals[0]
-		val = strings.TrimSpace(val)
-		switch key {
-		case "start":
-			start, _ = strconv.ParseInt(val, 10, 64)
-		case "rows":
-			rows, _ = strconv.ParseInt(val, 10, 64)
-		case "lastsearch":
-			lastsearch = val
-		case "searchtext":
-			search = val
-		case "visible":
-			status.SearchResultVisible = val == "true"
-		default:
-			if found := facetRegexp.FindStringSubmatch(key); found != nil {
-				fld := found[1]
-				if m := facetValRegexp.FindStringSubmatch(val); m != nil {
-					if _, ok := facets[fld]; !ok {
-						facets[fld] = TermFacet{
-							Selected: map[string]bool{},
-							Prefix:   "",
-							Limit:    0,
-						}
-					}
-					v := m[1]
-					if m[2] == "true" {
-						facets[fld].Selected[v] = true
-					} else {
-						//Facets[fld].Selected[v] = false
-					}
-				}
-			} else {
-				if found := filterRegexp.FindStringSubmatch(key); found != nil {
-					fld := found[1]
-					if _, ok := filterOrg[fld]; !ok {
-						filterOrg[fld] = []string{}
-					}
-					if val != "" {
-						filterOrg[fld] = append(filterOrg[fld], val)
-					}
-				}
-			}
-		}
+	sp := parseSearchParams(req.URL.Query(), facets)
+	start := sp.start
+	rows := sp.rows
+	search := sp.search
+	status.SearchResultVisible = sp.visible
+	filterOrg := sp.filterOrg
+	for _, mode := range s.mts.SearchModes() {
+		status.SearchModes = append(status.SearchModes, string(mode))
 	}
+	mode, ok := ParseSearchMode(sp.mode)
+	if !ok || !slices.Contains(status.SearchModes, string(mode)) {
+		status.Notifications = append(status.Notifications, Notification{
+			Id:      "notificationInvalidSearchMode",
+			Message: fmt.Sprintf("search mode %s not available", sp.mode),
+		})
+		mode = SearchModeLexical
+	}
+	status.SearchMode = string(mode)
 
-	if start < 0 {
-		start = 0
+	status.SearchSorts = SortOptions
+	sortOrder, err := ParseSortOrder(sp.sort)
+	if err != nil {
+		status.Notifications = append(status.Notifications, Notification{
+			Id:      "notificationInvalidSort",
+			Message: err.Error(),
+		})
 	}
-	if search != lastsearch {
-		start = 0
+	status.SearchSort = sortOrder.String()
+	lang := MatchLanguage(sp.lang, req.Header.Get("Accept-Language"))
+	// ranking and title sort depend on the query language
+	if sp.lang == "" {
+		w.Header().Add("Vary", "Accept-Language")
+	}
+
+	dateFacets := DateFacets(time.Now())
+	status.DateFacetSelected = sp.ranges
+	rangeFilters, err := RangeFilters(dateFacets, sp.ranges)
+	if err != nil {
+		status.Notifications = append(status.Notifications, Notification{
+			Id:      "notificationInvalidRange",
+			Message: err.Error(),
+		})
+		status.DateFacetSelected = map[string]string{}
 	}
 
 	var showJSON bool
-	filterOrg, filterField, qstr := s.string2QList(search, filterOrg)
+	filterOrg, filterField, qstr, err := s.parseSearchString(search, filterOrg)
+	if err != nil {
+		status.Notifications = append(status.Notifications, Notification{
+			Id:      "notificationQuerySyntax",
+			Message: err.Error(),
+		})
+	}
+	// semantic and hybrid hits are ranked by similarity
+	if rankedBySimilarity(mode, qstr) && !sortOrder.IsRelevance() {
+		status.Notifications = append(status.Notifications, Notification{
+			Id:      "notificationInvalidSort",
+			Message: fmt.Sprintf("sort %s not available in search mode %s", sortOrder, mode),
+		})
+		sortOrder = SortOrder{Field: SortRelevance}
+		status.SearchSort = sortOrder.String()
+	}
 	subfiltername := vars["subfilter"]
 	if subfiltername == "data" {
 		subfiltername = ""
@@ -283,7 +272,7 @@ func (s *Server) searchHandler(w http.ResponseWriter, req *http.Request) {
 		}
 		if f == nil {
 			// load as collection
-			doc, err := s.mts.LoadEntity(subfiltername)
+			doc, err := s.mts.LoadEntity(req.Context(), subfiltername)
 			if err != nil {
 				s.DoPanicf(nil, req, w, http.StatusNotFound, "error loading signature %s: %v", false, subfiltername, err)
 				return
@@ -341,10 +330,27 @@ func (s *Server) searchHandler(w http.ResponseWriter, req *http.Request) {
 		}
 	}
 
-	if len(filterField) == 0 && qstr == "" {
-		total, facets, err := s.mts.StatsByACL(s.baseCatalog)
+	status.FeedAtom, status.FeedRSS = s.feedLinks(req)
+	if sp.feed != "" {
+		s.addBaseCatalog(filterField)
+		s.feedHandler(w, req, sp.feed, status.Title, &SearchConfig{
+			Fields:         make(map[string][]string),
+			QStr:           qstr,
+			FiltersFields:  filterField,
+			Facets:         facets,
+			ContentVisible: sp.visible,
+			Rows:           int(rows),
+			RangeFilters:   rangeFilters,
+			Lang:           lang,
+		})
+		return
+	}
+
+	// browsing everything in a sort order needs a result list
+	if len(filterField) == 0 && qstr == "" && len(rangeFilters) == 0 && sortOrder.IsRelevance() {
+		total, facets, err := s.mts.StatsByACLContext(req.Context(), s.baseCatalog)
 		if err != nil {
-			s.DoPanicf(nil, req, w, http.StatusInternalServerError, "cannot get statistics: %v", false, err)
+			s.DoPanicf(nil, req, w, searchErrorStatus(w, err), "cannot get statistics: %v", false, err)
 			return
 		}
 		s.log.Info().Msgf("total records: %v", total)
@@ -353,7 +359,13 @@ func (s *Server) searchHandler(w http.ResponseWriter, req *http.Request) {
 		status.Stats = facets
 		status.SearchResultTotal = int(total)
 
-		result, err := s.queryCache.Get("empty")
+		// the notifications of invalid parameters are not part of the cache key, such pages are never cached
+		cacheable := len(status.Notifications) == 0
+		var result interface{}
+		err = gcache.KeyNotFoundError
+		if cacheable {
+			result, err = s.queryCache.Get("empty")
+		}
 		if err != nil && err != gcache.KeyNotFoundError {
 			s.DoPanicf(nil, req, w, http.StatusInternalServerError, "cannot access cache: %v", false, err)
 			return
@@ -386,20 +398,17 @@ func (s *Server) searchHandler(w http.ResponseWriter, req *http.Request) {
 					s.DoPanicf(nil, req, w, http.StatusInternalServerError, "cannot render template: %v", false, err)
 					return
 				}
-				if err := s.queryCache.Set("empty", Compress(cacheBuffer.Bytes())); err != nil {
-					s.DoPanicf(nil, req, w, http.StatusInternalServerError, "cannot cache result: %v", false, err)
-					return
+				if cacheable {
+					if err := s.queryCache.Set("empty", Compress(cacheBuffer.Bytes())); err != nil {
+						s.DoPanicf(nil, req, w, http.StatusInternalServerError, "cannot cache result: %v", false, err)
+						return
+					}
 				}
 			}
 		}
 	}
 
-	if len(s.baseCatalog) > 0 {
-		if _, ok := filterField["catalog"]; !ok {
-			filterField["catalog"] = []string{}
-		}
-		filterField["catalog"] = append(filterField["catalog"], s.baseCatalog...)
-	}
+	s.addBaseCatalog(filterField)
 	cfg := &SearchConfig{
 		Fields:         make(map[string][]string),
 		QStr:           qstr,
@@ -410,15 +419,36 @@ func (s *Server) searchHandler(w http.ResponseWriter, req *http.Request) {
 		Start:          int(start),
 		Rows:           int(rows),
 		IsAdmin:        status.User.inGroup(s.adminGroup),
+		Mode:           mode,
+		RangeFacets:    dateFacets,
+		RangeFilters:   rangeFilters,
+		Cursor:         sp.cursor,
+		Sort:           sortOrder,
+		Lang:           lang,
+	}
+	if sp.debug && cfg.IsAdmin {
+		cfg.Debug = &SearchDebug{}
+	}
+	if cfg.Cursor != "" {
+		// the cursor of the next page button is only valid if nothing else changed
+		if cursor, err := parseSearchCursor(cfg); err != nil || cursor.Offset != int(start) {
+			cfg.Cursor = ""
+		}
 	}
 
-	hk, err := Hash(cfg)
+	hk, err := cfg.CacheKey()
 	if err != nil {
 		s.DoPanicf(nil, req, w, http.StatusInternalServerError, "cannot hash config: %v", false, err)
 		return
 	}
 
-	result, err := s.queryCache.Get(hk)
+	var result interface{}
+	err = gcache.KeyNotFoundError
+	// the debug panel and the notifications of invalid parameters are never cached
+	cacheable := cfg.Debug == nil && len(status.Notifications) == 0
+	if cacheable {
+		result, err = s.queryCache.Get(hk)
+	}
 	if err != nil && err != gcache.KeyNotFoundError {
 		s.DoPanicf(nil, req, w, http.StatusInternalServerError, "cannot access cache: %v", false, err)
 		return
@@ -431,20 +461,63 @@ func (s *Server) searchHandler(w http.ResponseWriter, req *http.Request) {
 			return
 		}
 		w.Header().Set("Cache-Control", "max-age=14400, s-maxage=12200, stale-while-revalidate=9000, public")
+		s.recordSearch(hk, cfg, search, facets, sp.ranges, -1)
 		io.WriteString(w, string(dt))
 		return
 	}
 
-	highlights, docs, total, facetFieldCount, err := s.mts.Search(cfg)
+	searchBegin := time.Now()
+	highlights, docs, total, facetFieldCount, next, err := s.mts.SearchContext(req.Context(), cfg)
 	if err != nil {
-		s.DoPanicf(nil, req, w, http.StatusInternalServerError, "cannot execute solr query: %v", false, err)
+		s.DoPanicf(nil, req, w, searchErrorStatus(w, err), "cannot execute solr query: %v", false, err)
 		return
 	}
-	status.Result, err = s.doc2result("", "", docs, total, facetFieldCount, facets, 0, &status.BaseStatus, "", highlights)
+	if cfg.Debug != nil {
+		cfg.Debug.Duration = time.Since(searchBegin).Milliseconds()
+		status.Debug = cfg.Debug
+	}
+	s.recordSearch(hk, cfg, search, facets, sp.ranges, total)
+	status.Result, err = s.doc2result("", "", docs, total, facetFieldCount, facets, 0, &status.BaseStatus, next, highlights)
 	if err != nil {
 		s.DoPanicf(nil, req, w, http.StatusInternalServerError, "cannot marshal result: %v", false, err)
 		return
 	}
+	status.Result.TotalEstimated = cfg.TotalEstimated()
+	status.SearchResultNext = next
+	if total == 0 && qstr != "" {
+		suggestions, err := s.mts.DidYouMean(req.Context(), cfg)
+		if err != nil {
+			s.log.Error().Msgf("cannot get spelling suggestions for '%s': %v", qstr, err)
+		}
+		for _, suggestion := range suggestions {
+			values := req.URL.Query()
+			values.Set("searchtext", ApplyCorrections(search, suggestion.Corrections))
+			values.Del("start")
+			values.Del("cursor")
+			values.Del("lastsearch")
+			suggestion.Link = fmt.Sprintf("%s/%s?%s", status.RelPath, s.prefixes["search"], values.Encode())
+			status.DidYouMean = append(status.DidYouMean, suggestion)
+		}
+	}
+	status.Result.DateFacetCount = dateFacetCount(dateFacets, facetFieldCount)
+	for name, df := range dateFacets {
+		if df.Type != FacetTypeRange {
+			continue
+		}
+		for _, r := range df.Ranges {
+			count := facetFieldCount[name][r.Key]
+			selected := status.DateFacetSelected[name] == r.Key
+			if count == 0 && !selected {
+				continue
+			}
+			status.DateFacet[name] = append(status.DateFacet[name], FacetCountField{
+				Id:        fmt.Sprintf("range_%s_%s", name, r.Key),
+				Name:      fmt.Sprintf("%s (%d)", dateFacetLabel(name, r.Key), count),
+				ShortName: r.Key,
+				Selected:  selected,
+			})
+		}
+	}
 
 	// todo: MD5 for facet names
 
@@ -459,6 +532,11 @@ func (s *Server) searchHandler(w http.ResponseWriter, req *http.Request) {
 		vals := f.Restrict
 		facet := f.Field
 		status.Facet[facet] = map[string]FacetCountField{}
+		if tree, ok := status.Result.FacetTree[facet]; ok {
+			status.FacetTree[facet] = tree
+			addFacetNodes(status.Facet[facet], tree)
+			continue
+		}
 		for val, _ := range vals {
 			if len(val) == 0 {
 				continue
@@ -528,7 +606,11 @@ func (s *Server) searchHandler(w http.ResponseWriter, req *http.Request) {
 			return
 		}
 	} else {
-		w.Header().Set("Cache-Control", "max-age=14400, s-maxage=12200, stale-while-revalidate=9000, public")
+		if status.Debug != nil {
+			w.Header().Set("Cache-Control", "private, no-store")
+		} else {
+			w.Header().Set("Cache-Control", "max-age=14400, s-maxage=12200, stale-while-revalidate=9000, public")
+		}
 		s.log.Info().Msgf("search.amp.gohtml")
 		if tpl, ok := s.templates["search.amp.gohtml"]; ok {
 			var cacheBuffer bytes.Buffer
@@ -537,6 +619,9 @@ func (s *Server) searchHandler(w http.ResponseWriter, req *http.Request) {
 				s.DoPanicf(nil, req, w, http.StatusInternalServerError, "cannot render template: %v", false, err)
 				return
 			}
+			if !cacheable {
+				return
+			}
 			if err := s.queryCache.Set(hk, Compress(cacheBuffer.Bytes())); err != nil {
 				s.DoPanicf(nil, req, w, http.StatusInternalServerError, "cannot cache result: %v", false, err)
 				return
@@ -545,3 +630,158 @@ func (s *Server) searchHandler(w http.ResponseWriter, req *http.Request) {
 	}
 	return
 }
+
+type searchParams struct {
+	start      int64
+	rows       int64
+	search     string
+	lastsearch string
+	visible    bool
+	mode       string
+	cursor     string
+	sort       string
+	lang       string
+	debug      bool
+	feed       string
+	filterOrg  map[string][]string
+	ranges     map[string]string
+}
+
+/*
+parseSearchParams reads the query parameters of the search form.
+selected facet values are added to facets
+*/
+func parseSearchParams(values url.Values, facets map[string]TermFacet) *searchParams {
+	params := &searchParams{
+		start:     0,
+		rows:      10,
+		filterOrg: make(map[string][]string),
+		ranges:    make(map[string]string),
+	}
+	for key, vals := range values {
+		if len(vals) == 0 {
+			continue
+		}
+		val := vals[0]
+		val = strings.TrimSpace(val)
+		switch key {
+		case "start":
+			params.start, _ = strconv.ParseInt(val, 10, 64)
+		case "rows":
+			params.rows, _ = strconv.ParseInt(val, 10, 64)
+		case "lastsearch":
+			params.lastsearch = val
+		case "searchtext":
+			params.search = val
+		case "visible":
+			params.visible = val == "true"
+		case "mode":
+			params.mode = val
+		case "cursor":
+			params.cursor = val
+		case "sort":
+			params.sort = val
+		case "lang":
+			params.lang = val
+		case "debug":
+			params.debug = val == "true"
+		case "feed":
+			params.feed = val
+		default:
+			if found := facetRegexp.FindStringSubmatch(key); found != nil {
+				fld := found[1]
+				if m := facetValRegexp.FindStringSubmatch(val); m != nil {
+					if _, ok := facets[fld]; !ok {
+						facets[fld] = TermFacet{
+							Selected: map[string]bool{},
+							Prefix:   "",
+							Limit:    0,
+						}
+					}
+					v := m[1]
+					if m[2] == "true" {
+						facets[fld].Selected[v] = true
+					} else {
+						//Facets[fld].Selected[v] = false
+					}
+				}
+			} else if found := rangeRegexp.FindStringSubmatch(key); found != nil {
+				if val != "" {
+					params.ranges[found[1]] = val
+				}
+			} else {
+				if found := filterRegexp.FindStringSubmatch(key); found != nil {
+					fld := found[1]
+					if _, ok := params.filterOrg[fld]; !ok {
+						params.filterOrg[fld] = []string{}
+					}
+					if val != "" {
+						params.filterOrg[fld] = append(params.filterOrg[fld], val)
+					}
+				}
+			}
+		}
+	}
+
+	for _, facet := range facets {
+		if facet.Type == FacetTypeHierarchy {
+			hierarchyNormalizeSelection(facet.Selected)
+		}
+	}
+	if params.start < 0 {
+		params.start = 0
+	}
+	if params.search != params.lastsearch {
+		params.start = 0
+	}
+	return params
+}
+
+// defaultFacets returns the configured facets and the names of the core facet fields
+func (s *Server) defaultFacets() (map[string]TermFacet, []string) {
+	facets := map[string]TermFacet{}
+	coreFacets := []string{}
+	for _, val := range s.facets {
+		if _, ok := facets[val.Field]; !ok {
+			facets[val.Field] = TermFacet{
+				Selected: map[string]bool{},
+				Prefix:   "",
+				Limit:    0,
+				Type:     val.Type,
+			}
+		}
+		for v, sel := range val.Restrict {
+			facets[val.Field].Selected[v] = sel
+		}
+		coreFacets = append(coreFacets, val.Field)
+	}
+	return facets, coreFacets
+}
+
+// addFacetNodes adds the nodes of a hierarchical facet to the form fields of the facet
+func addFacetNodes(fields map[string]FacetCountField, nodes []*FacetNode) {
+	for _, node := range nodes {
+		fields[node.Id] = FacetCountField{
+			Id:        node.Id,
+			Name:      fmt.Sprintf("%s (%d)", node.Name, node.Count),
+			ShortName: node.Path,
+			Selected:  node.Selected,
+		}
+		addFacetNodes(fields, node.Children)
+	}
+}
+
+// locationGroups returns the groups of the networks the client address belongs to
+func (s *Server) locationGroups(req *http.Request) []string {
+	ip, _, _ := net.SplitHostPort(req.RemoteAddr)
+	return s.locations.Contains(ip)
+}
+
+func (s *Server) addBaseCatalog(filterField map[string][]string) {
+	if len(s.baseCatalog) > 0 {
+		if _, ok := filterField["catalog"]; !ok {
+			filterField["catalog"] = []string{}
+		}
+		filterField["catalog"] = append(filterField["catalog"], s.baseCatalog...)
+	}
+}
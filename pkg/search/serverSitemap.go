@@ -1,6 +1,7 @@
 package search
 
 import (
+	"context"
 	"fmt"
 	"github.com/je4/sitemap/v2"
 	"github.com/pkg/errors"
@@ -8,7 +9,7 @@ import (
 	"time"
 )
 
-func (s *Server) buildSitemap() error {
+func (s *Server) buildSitemap(ctx context.Context) error {
 	var size int64 = 3000
 	cfg := &ScrollConfig{
 		FiltersFields:  map[string][]string{"catalog": s.baseCatalog},
@@ -25,7 +26,7 @@ func (s *Server) buildSitemap() error {
 
 	var sitemapPrefix = "zsearch"
 
-	if err := s.mts.se.Scroll(cfg, func(data *SourceData) error {
+	if err := s.mts.se.Scroll(ctx, cfg, func(data *SourceData) error {
 		//		log.Info().Msgf("%0.5d - %v", counter, data.Signature)
 		if counter%size == 0 {
 			if counter > 0 {
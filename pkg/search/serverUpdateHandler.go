@@ -35,7 +35,7 @@ func (s *Server) updateHandler(w http.ResponseWriter, req *http.Request) {
 		s.DoPanicf(nil, req, w, http.StatusInternalServerError, "no amp configured", false)
 		return
 	}
-	doc, err := s.mts.LoadEntity(signature)
+	doc, err := s.mts.LoadEntity(req.Context(), signature)
 	if err != nil {
 		s.DoPanicf(nil, req, w, http.StatusNotFound, "error loading signature %s: %v", false, signature, err)
 		return
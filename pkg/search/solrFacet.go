@@ -6,6 +6,7 @@ type SolrFacet struct {
 	Field    string          `json:"field"`
 	Prefix   string          `json:"Prefix,omitempty"`
 	Restrict map[string]bool `json:"restrict,omitempty"`
+	Type     FacetType       `json:"type,omitempty"`
 }
 
 type SolrFacetList map[string]SolrFacet
@@ -0,0 +1,205 @@
+package search
+
+import (
+	"fmt"
+	"github.com/je4/zsearch/v2/pkg/translate"
+	"golang.org/x/text/language"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+	"strings"
+	"unicode"
+)
+
+type SortField string
+
+const (
+	SortRelevance SortField = "relevance"
+	SortDate      SortField = "date"
+	SortTitle     SortField = "title"
+	SortDateAdded SortField = "dateadded"
+	SortSignature SortField = "signature"
+)
+
+var SortFields = []SortField{SortRelevance, SortDate, SortTitle, SortDateAdded, SortSignature}
+
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+// SortOptions are the sort orders offered in the search form
+var SortOptions = []SortOrder{
+	{Field: SortRelevance},
+	{Field: SortDate, Order: SortDesc},
+	{Field: SortDate, Order: SortAsc},
+	{Field: SortTitle, Order: SortAsc},
+	{Field: SortTitle, Order: SortDesc},
+	{Field: SortDateAdded, Order: SortDesc},
+	{Field: SortDateAdded, Order: SortAsc},
+	{Field: SortSignature, Order: SortAsc},
+	{Field: SortSignature, Order: SortDesc},
+}
+
+// SortLanguages are the languages with a title sort key and language analyzed title and abstract, the first one is the default
+var SortLanguages = []language.Tag{language.German, language.English, language.French, language.Italian}
+
+var sortLanguageMatcher = language.NewMatcher(SortLanguages)
+
+// MatchLanguage returns the sort language for the given languages (e.g. a parameter and the Accept-Language header)
+func MatchLanguage(langs ...string) string {
+	tag, _ := language.MatchStrings(sortLanguageMatcher, langs...)
+	base, _ := tag.Base()
+	return base.String()
+}
+
+/*
+SortOrder is the sort criteria of a search.
+without Order the natural direction of the field is used: newest and best hits first, titles and signatures from A to Z
+*/
+type SortOrder struct {
+	Field SortField `json:"field,omitempty"`
+	Order string    `json:"order,omitempty"`
+}
+
+// ParseSortOrder parses "<field>" or "<field>:<asc|desc>", an empty string is relevance
+func ParseSortOrder(str string) (SortOrder, error) {
+	field, order, _ := strings.Cut(strings.TrimSpace(str), ":")
+	so := SortOrder{Field: SortField(field), Order: order}
+	if so.Field == "" {
+		so.Field = SortRelevance
+	}
+	found := false
+	for _, f := range SortFields {
+		if f == so.Field {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return SortOrder{}, fmt.Errorf("unknown sort field '%s'", field)
+	}
+	if so.Order != "" && so.Order != SortAsc && so.Order != SortDesc {
+		return SortOrder{}, fmt.Errorf("unknown sort order '%s'", order)
+	}
+	return so, nil
+}
+
+func (so SortOrder) String() string {
+	return fmt.Sprintf("%s:%s", so.field(), so.order())
+}
+
+// Label is the name of the sort order in the search form
+func (so SortOrder) Label() string {
+	asc := so.order() == SortAsc
+	switch so.field() {
+	case SortDate:
+		if asc {
+			return "date (oldest first)"
+		}
+		return "date (newest first)"
+	case SortTitle:
+		if asc {
+			return "title (A-Z)"
+		}
+		return "title (Z-A)"
+	case SortDateAdded:
+		if asc {
+			return "added (oldest first)"
+		}
+		return "recently added"
+	case SortSignature:
+		if asc {
+			return "signature (A-Z)"
+		}
+		return "signature (Z-A)"
+	}
+	if asc {
+		return "relevance (ascending)"
+	}
+	return "relevance"
+}
+
+func (so SortOrder) IsRelevance() bool {
+	return so.field() == SortRelevance
+}
+
+func (so SortOrder) field() SortField {
+	if so.Field == "" {
+		return SortRelevance
+	}
+	return so.Field
+}
+
+// order returns the explicit or the natural direction of the field
+func (so SortOrder) order() string {
+	if so.Order != "" {
+		return so.Order
+	}
+	switch so.field() {
+	case SortTitle, SortSignature:
+		return SortAsc
+	}
+	return SortDesc
+}
+
+// indexField returns the field of the index to sort on, "" for relevance
+func (so SortOrder) indexField(lang string) string {
+	switch so.field() {
+	case SortDate:
+		return "itemdate"
+	case SortTitle:
+		return "titlesort." + sortLanguage(lang)
+	case SortDateAdded:
+		return "dateadded"
+	case SortSignature:
+		return "signature"
+	}
+	return ""
+}
+
+// sortLanguage returns the sort language for a language code, unknown languages use the default
+func sortLanguage(lang string) string {
+	tag, err := language.Parse(lang)
+	if err == nil {
+		base, _ := tag.Base()
+		for _, l := range SortLanguages {
+			if lb, _ := l.Base(); lb == base {
+				return base.String()
+			}
+		}
+	}
+	base, _ := SortLanguages[0].Base()
+	return base.String()
+}
+
+var sortKeyTransformer = transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+// titleSortKey removes case and diacritics, so that "Émile" sorts next to "emil"
+func titleSortKey(title string) string {
+	key, _, err := transform.String(sortKeyTransformer, title)
+	if err != nil {
+		key = title
+	}
+	return strings.ToLower(strings.TrimSpace(key))
+}
+
+/*
+titleSortKeys creates the sort key of the title for every sort language.
+languages without (translated) title use the original title
+*/
+func titleSortKeys(title *translate.MultiLangString) map[string]string {
+	if title == nil || len(*title) == 0 {
+		return nil
+	}
+	keys := map[string]string{}
+	for _, lang := range SortLanguages {
+		base, _ := lang.Base()
+		str := title.Get(lang)
+		if str == "" {
+			str = title.String()
+		}
+		keys[base.String()] = titleSortKey(str)
+	}
+	return keys
+}
@@ -35,6 +35,10 @@ type SourceData struct {
 	Series            string                     `json:"series"`
 	Place             string                     `json:"place"`
 	Date              string                     `json:"date"`
+	ItemDate          *time.Time                 `json:"itemdate,omitempty"`
+	TitleSort         map[string]string          `json:"titlesort,omitempty"`
+	TitleLang         *LangText                  `json:"titlelang,omitempty"`
+	AbstractLang      *LangText                  `json:"abstractlang,omitempty"`
 	CollectionTitle   string                     `json:"collectiontitle"`
 	Persons           []Person                   `json:"persons"`
 	ACL               map[string][]string        `json:"acl"`
@@ -101,15 +105,19 @@ func NewSourceData(src Source) (*SourceData, error) {
 		Mediatype:         []string{},
 		Timestamp:         time.Now(),
 	}
+	sd.ItemDate = normalizeItemDate(sd.Date)
+	sd.TitleSort = titleSortKeys(sd.Title)
+	sd.TitleLang = newLangText(sd.Title)
+	sd.AbstractLang = newLangText(sd.Abstract)
 	sd.HasMedia = len(sd.Media) > 0
 	for mt, _ := range sd.Media {
 		sd.Mediatype = append(sd.Mediatype, mt)
 	}
 	categories := []string{}
 	for _, cat := range sd.Category {
-		parts := strings.Split(cat, "!!")
+		parts := strings.Split(cat, HierarchySeparator)
 		for i := 0; i < len(parts); i++ {
-			categories = append(categories, strings.Join(parts[:i+1], "!!"))
+			categories = append(categories, strings.Join(parts[:i+1], HierarchySeparator))
 		}
 	}
 	slices.Sort(categories)
@@ -124,6 +132,9 @@ func (sd *SourceData) Translate(tr translate.Translator, langs []language.Tag) {
 	if err := tr.Translate(sd.Abstract, langs); err != nil {
 		fmt.Printf("cannot translate abstract: %v\n", err)
 	}
+	sd.TitleSort = titleSortKeys(sd.Title)
+	sd.TitleLang = newLangText(sd.Title)
+	sd.AbstractLang = newLangText(sd.Abstract)
 }
 
 func (sd *SourceData) CreateEmbedding(embeddings *openai.ClientV2, tpl *template.Template, available []string) {
@@ -152,6 +163,18 @@ func (sd *SourceData) CreateEmbedding(embeddings *openai.ClientV2, tpl *template
 	sd.ContentVector = vec.Embedding
 }
 
+/*
+Copy returns a copy of the document which can be changed without affecting other users of sd.
+only the references are copied deep, the other fields must not be changed
+*/
+func (sd *SourceData) Copy() *SourceData {
+	c := *sd
+	if sd.References != nil {
+		c.References = append([]Reference{}, sd.References...)
+	}
+	return &c
+}
+
 func (sd *SourceData) SetStatistics() {
 	stats := &SourceStatistic{
 		MediaType:     []string{},
@@ -0,0 +1,165 @@
+package search
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// maximum number of corrected queries which are checked for hits
+const spellMaxCandidates = 4
+
+// maximum edit distance of a correction
+const spellMaxEdits = 2
+
+/*
+SpellSuggestion is a corrected query with hits.
+Corrections maps the misspelled words (lower case) to their replacement, so they can be applied to the search string of the user
+*/
+type SpellSuggestion struct {
+	Query       string            `json:"query"`
+	Corrections map[string]string `json:"corrections"`
+	Total       int64             `json:"total"`
+	Link        string            `json:"link,omitempty"`
+}
+
+// spellOption is a correction of a word, better options have a higher score or appear in more documents
+type spellOption struct {
+	Text  string
+	Score float64
+	Freq  int64
+}
+
+// levenshtein returns the edit distance of two words
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// bestSpellOptions sorts the options of every word and removes duplicates
+func bestSpellOptions(options map[string][]spellOption) map[string][]string {
+	result := map[string][]string{}
+	for word, opts := range options {
+		sort.SliceStable(opts, func(i, j int) bool {
+			if opts[i].Score != opts[j].Score {
+				return opts[i].Score > opts[j].Score
+			}
+			return opts[i].Freq > opts[j].Freq
+		})
+		seen := map[string]bool{}
+		for _, opt := range opts {
+			text := strings.ToLower(opt.Text)
+			if text == word || seen[text] {
+				continue
+			}
+			seen[text] = true
+			result[word] = append(result[word], text)
+		}
+	}
+	return result
+}
+
+// ApplyCorrections replaces the misspelled words of str, query syntax and the other words are kept
+func ApplyCorrections(str string, corrections map[string]string) string {
+	return wordsRegexp.ReplaceAllStringFunc(str, func(word string) string {
+		if replacement, ok := corrections[strings.ToLower(word)]; ok {
+			return replacement
+		}
+		return word
+	})
+}
+
+/*
+spellCandidates creates the corrections to check: all words corrected with their best option,
+then every single word with each of its options
+*/
+func spellCandidates(options map[string][]string) []map[string]string {
+	words := []string{}
+	for word := range options {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+
+	candidates := []map[string]string{}
+	seen := map[string]bool{}
+	add := func(c map[string]string) {
+		keys := []string{}
+		for w, r := range c {
+			keys = append(keys, w+"="+r)
+		}
+		sort.Strings(keys)
+		key := strings.Join(keys, ",")
+		if len(c) == 0 || seen[key] || len(candidates) >= spellMaxCandidates {
+			return
+		}
+		seen[key] = true
+		candidates = append(candidates, c)
+	}
+	all := map[string]string{}
+	for _, word := range words {
+		all[word] = options[word][0]
+	}
+	add(all)
+	for _, word := range words {
+		for _, opt := range options[word] {
+			add(map[string]string{word: opt})
+		}
+	}
+	return candidates
+}
+
+/*
+spellSuggestions checks the corrected queries with count, so only suggestions with visible hits are offered.
+the suggestions with the most hits come first
+*/
+func spellSuggestions(qstr string, options map[string][]spellOption, count func(qstr string) (int64, error)) ([]SpellSuggestion, error) {
+	result := []SpellSuggestion{}
+	for _, corrections := range spellCandidates(bestSpellOptions(options)) {
+		query := ApplyCorrections(qstr, corrections)
+		total, err := count(query)
+		if err != nil {
+			return nil, err
+		}
+		if total == 0 {
+			continue
+		}
+		result = append(result, SpellSuggestion{Query: query, Corrections: corrections, Total: total})
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Total > result[j].Total
+	})
+	return result, nil
+}
+
+// spellCount returns a function which counts the hits of a corrected query with the filters of cfg
+func spellCount(ctx context.Context, cfg *SearchConfig, search func(ctx context.Context, cfg *SearchConfig) ([]map[string][]string, []*SourceData, int64, FacetCountResult, string, error)) func(qstr string) (int64, error) {
+	return func(qstr string) (int64, error) {
+		c := *cfg
+		c.QStr = qstr
+		c.Start = 0
+		c.Rows = 0
+		c.Cursor = ""
+		c.Facets = nil
+		c.RangeFacets = nil
+		c.Mode = SearchModeLexical
+		c.Debug = nil
+		_, _, total, _, _, err := search(ctx, &c)
+		return total, err
+	}
+}
@@ -0,0 +1,103 @@
+package search
+
+import (
+	"sort"
+	"strings"
+)
+
+type SuggestionType string
+
+const (
+	SuggestionTitle    SuggestionType = "title"
+	SuggestionPerson   SuggestionType = "person"
+	SuggestionTag      SuggestionType = "tag"
+	SuggestionCategory SuggestionType = "category"
+)
+
+// number of documents the suggestions are taken from
+const suggestDocs = 50
+
+/*
+Suggestion is a completion of the typed text.
+Value can be used as search term or filter, Label is shown to the user (the last level of a category)
+*/
+type Suggestion struct {
+	Type  SuggestionType `json:"type"`
+	Value string         `json:"value"`
+	Label string         `json:"label"`
+	Count int            `json:"count"`
+}
+
+// suggestWords returns the words of the typed text without case and diacritics
+func suggestWords(text string) []string {
+	return wordsRegexp.FindAllString(titleSortKey(text), -1)
+}
+
+// suggestMatch is true if every typed word is the beginning of a word of value
+func suggestMatch(value string, words []string) bool {
+	if len(words) == 0 {
+		return false
+	}
+	valueWords := wordsRegexp.FindAllString(titleSortKey(value), -1)
+	for _, word := range words {
+		found := false
+		for _, vw := range valueWords {
+			if strings.HasPrefix(vw, word) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+collectSuggestions takes the matching values from the documents of the suggest query.
+values of many documents come first, otherwise the order of the hits is kept
+*/
+func collectSuggestions(docs []*SourceData, text string, limit int) []Suggestion {
+	words := suggestWords(text)
+	result := []Suggestion{}
+	index := map[string]int{}
+	add := func(t SuggestionType, value, label string) {
+		if !suggestMatch(label, words) {
+			return
+		}
+		key := string(t) + ":" + value
+		if i, ok := index[key]; ok {
+			result[i].Count++
+			return
+		}
+		index[key] = len(result)
+		result = append(result, Suggestion{Type: t, Value: value, Label: label, Count: 1})
+	}
+	for _, doc := range docs {
+		if doc.Title != nil {
+			title := doc.Title.String()
+			add(SuggestionTitle, title, title)
+		}
+		for _, name := range relatedPersons(doc) {
+			add(SuggestionPerson, name, name)
+		}
+		for _, tag := range doc.Tags {
+			add(SuggestionTag, tag, tag)
+		}
+		for _, cat := range doc.Category {
+			label := cat
+			if parent := hierarchyParent(cat); parent != "" {
+				label = cat[len(parent)+len(HierarchySeparator):]
+			}
+			add(SuggestionCategory, cat, label)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Count > result[j].Count
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}